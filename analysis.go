@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/faiface/pixel"
+)
+
+// Settings for the test situations a creature is analysed in
+type analysisOptions struct {
+	Trials      int     `json:"trials"`       // The number of seeded environments each ablation is tested in
+	Duration    float64 `json:"duration"`     // The number of sim seconds each trial lasts
+	Copies      int     `json:"copies"`       // The number of copies of the creature in each trial
+	MapRadius   int     `json:"map_radius"`   // The radius of the map used for the trials
+	FoodDensity float64 `json:"food_density"` // The density of food scattered at the start of a trial
+	NoiseSize   float64 `json:"noise_size"`   // The standard deviation of the noise added to an input when it is perturbed
+	Seed        int64   `json:"seed"`         // The seed of the first trial. Trial i uses seed+i
+}
+
+// The effect of changing one input of a creature's brain
+type AblationEffect struct {
+	OutputChange []float64 `json:"output_change"` // The mean absolute change in each brain output, when replaying the inputs of the baseline trials
+	SurvivalTime float64   `json:"survival_time"` // The mean number of seconds a copy survived for with the input changed
+}
+
+// How much a creature depends on one of its brain inputs
+type InputSensitivity struct {
+	Index     int            `json:"index"`
+	Name      string         `json:"name"`
+	Zeroed    AblationEffect `json:"zeroed"`    // The input is always zero
+	Perturbed AblationEffect `json:"perturbed"` // Noise is added to the input
+}
+
+type SensitivityReport struct {
+	DNAFile              string             `json:"dna_file"`
+	Options              analysisOptions    `json:"options"`
+	Outputs              []string           `json:"outputs"`
+	BaselineSurvivalTime float64            `json:"baseline_survival_time"`
+	Inputs               []InputSensitivity `json:"inputs"`
+}
+
+func analyseCommand(args []string) error {
+	fs := flag.NewFlagSet("analyse", flag.ContinueOnError)
+	opts := analysisOptions{}
+	fs.IntVar(&opts.Trials, "trials", 3, "number of seeded trials per ablation")
+	fs.Float64Var(&opts.Duration, "duration", 60, "length of each trial in sim seconds")
+	fs.IntVar(&opts.Copies, "copies", 10, "number of copies of the creature in each trial")
+	fs.IntVar(&opts.MapRadius, "radius", 100, "radius of the map used for the trials")
+	fs.Float64Var(&opts.FoodDensity, "food", 0.01, "density of food scattered at the start of each trial")
+	fs.Float64Var(&opts.NoiseSize, "noise", 0.5, "standard deviation of the noise used to perturb an input")
+	fs.Int64Var(&opts.Seed, "seed", 1, "seed of the first trial")
+	outPath := fs.String("o", "", "path to write the JSON report to (default data/analysis/<dna file name>.json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one DNA file")
+	}
+	dnaPath := fs.Arg(0)
+	dna, err := LoadDNAFile(dnaPath)
+	if err != nil {
+		return err
+	}
+	gtCounter.SafeWith(dna.Genotype)
+
+	report, err := AnalyseSensitivity(dna, opts)
+	if err != nil {
+		return err
+	}
+	report.DNAFile = dnaPath
+	report.WriteTable(os.Stdout)
+
+	if *outPath == "" {
+		name := strings.TrimSuffix(filepath.Base(dnaPath), filepath.Ext(dnaPath))
+		*outPath = filepath.Join("data", "analysis", name+".json")
+	}
+	if err := os.MkdirAll(filepath.Dir(*outPath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*outPath, data, 0644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote report to", *outPath)
+	return nil
+}
+
+// Test how much a creature's outputs and survival depend on each of its brain inputs.
+// The creature is first run in some seeded test environments to record what it senses.
+// Those recordings are replayed through its brain with each input zeroed or perturbed to measure the change in output,
+// then the trials are run again with the input changed to measure the change in survival
+func AnalyseSensitivity(dna CreatureDNA, opts analysisOptions) (SensitivityReport, error) {
+	if opts.Trials < 1 || opts.Copies < 1 || opts.Duration <= 0 {
+		return SensitivityReport{}, errors.New("trials, copies and duration must all be positive")
+	}
+	testCreature := NewCreature(dna)
+	if dna.Genotype.NumIn != testCreature.NumInputs() {
+		return SensitivityReport{}, fmt.Errorf("creature brain has %d inputs but creatures have %d", dna.Genotype.NumIn, testCreature.NumInputs())
+	}
+	inputNames := testCreature.InputNames()
+
+	// Record the baseline
+	episodes := make([][][]float64, 0)
+	baseline := 0.0
+	for t := 0; t < opts.Trials; t++ {
+		survival, recorded := runSensorTrial(dna, opts, opts.Seed+int64(t), nil, true)
+		baseline += survival / float64(opts.Trials)
+		episodes = append(episodes, recorded...)
+	}
+
+	report := SensitivityReport{
+		Options:              opts,
+		Outputs:              creatureOutputNames,
+		BaselineSurvivalTime: baseline,
+	}
+	// The noise has its own generator so that it does not change the random events of the trials
+	noise := rand.New(rand.NewSource(opts.Seed))
+	for i, name := range inputNames {
+		i := i
+		zero := func(inputs []float64) {
+			inputs[i] = 0
+		}
+		perturb := func(inputs []float64) {
+			inputs[i] += noise.NormFloat64() * opts.NoiseSize
+		}
+		report.Inputs = append(report.Inputs, InputSensitivity{
+			Index:     i,
+			Name:      name,
+			Zeroed:    measureAblation(dna, opts, episodes, zero),
+			Perturbed: measureAblation(dna, opts, episodes, perturb),
+		})
+	}
+	return report, nil
+}
+
+func measureAblation(dna CreatureDNA, opts analysisOptions, episodes [][][]float64, modify func([]float64)) AblationEffect {
+	effect := AblationEffect{
+		OutputChange: make([]float64, dna.Genotype.NumOut),
+	}
+	// Replay the recorded inputs through an unchanged and a changed brain side by side
+	numSteps := 0
+	for _, episode := range episodes {
+		original, changed := NewBrain(dna.Genotype), NewBrain(dna.Genotype)
+		for _, inputs := range episode {
+			changedInputs := append([]float64{}, inputs...)
+			modify(changedInputs)
+			a, b := original.Forward(inputs), changed.Forward(changedInputs)
+			for o := range a {
+				effect.OutputChange[o] += math.Abs(a[o] - b[o])
+			}
+			numSteps++
+		}
+	}
+	for o := range effect.OutputChange {
+		if numSteps > 0 {
+			effect.OutputChange[o] /= float64(numSteps)
+		}
+	}
+	// Run the trials again with the input changed
+	for t := 0; t < opts.Trials; t++ {
+		survival, _ := runSensorTrial(dna, opts, opts.Seed+int64(t), modify, false)
+		effect.SurvivalTime += survival / float64(opts.Trials)
+	}
+	return effect
+}
+
+// Run copies of a creature in a fresh environment made from `seed`, returning the mean time they survived for.
+// `modify` is applied to the brain inputs of each copy before every brain update, and may be nil.
+// If `record` is true, the unmodified brain inputs of each copy are also returned
+func runSensorTrial(dna CreatureDNA, opts analysisOptions, seed int64, modify func([]float64), record bool) (float64, [][][]float64) {
+	rand.Seed(seed)
+	env := NewEnvironment(opts.MapRadius)
+	env.ScatterFood(opts.FoodDensity)
+	copies := make([]*Creature, opts.Copies)
+	survival := make([]float64, opts.Copies)
+	recorded := make([][][]float64, opts.Copies)
+	for i := range copies {
+		i := i
+		c := NewCreature(dna.Copied())
+		// Spawn in the open area in the middle of the map
+		c.Pos = pixel.V(math.Sqrt(rand.Float64())*float64(opts.MapRadius)*0.25, 0).Rotated(rand.Float64() * 2 * math.Pi)
+		c.inputHook = func(inputs []float64) {
+			if record {
+				recorded[i] = append(recorded[i], append([]float64{}, inputs...))
+			}
+			if modify != nil {
+				modify(inputs)
+			}
+		}
+		copies[i] = c
+		env.Creatures.Add(c)
+	}
+
+	alive := opts.Copies
+	for env.SimTime.Seconds() < opts.Duration && alive > 0 {
+		env.Update(1 / 60.0)
+		for i, c := range copies {
+			if c != nil && !env.Creatures.Contains(c) {
+				survival[i] = env.SimTime.Seconds()
+				copies[i] = nil
+				alive--
+			}
+		}
+	}
+	mean := 0.0
+	for i, c := range copies {
+		if c != nil {
+			survival[i] = env.SimTime.Seconds()
+		}
+		mean += survival[i] / float64(opts.Copies)
+	}
+	return mean, recorded
+}
+
+// Write the report as a human readable table
+func (r SensitivityReport) WriteTable(f io.Writer) {
+	fmt.Fprintf(f, "Baseline survival time: %.1fs (%d trials of %.0fs, %d copies)\n\n", r.BaselineSurvivalTime, r.Options.Trials, r.Options.Duration, r.Options.Copies)
+	w := tabwriter.NewWriter(f, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := "input\t"
+	for _, mode := range []string{"zeroed", "perturbed"} {
+		for _, o := range r.Outputs {
+			header += fmt.Sprintf("%s d%s\t", mode, o)
+		}
+		header += mode + " survival\t"
+	}
+	fmt.Fprintln(w, header)
+	for _, in := range r.Inputs {
+		row := in.Name + "\t"
+		for _, effect := range []AblationEffect{in.Zeroed, in.Perturbed} {
+			for _, change := range effect.OutputChange {
+				row += fmt.Sprintf("%.3f\t", change)
+			}
+			row += fmt.Sprintf("%+.1fs\t", effect.SurvivalTime-r.BaselineSurvivalTime)
+		}
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/JoshPattman/goevo"
+)
+
+// Activations that goevo does not provide, but that our own brains can run
+const (
+	// y = 1 {x > 0} | y = 0 {x <= 0}
+	ActivationStep goevo.Activation = "step"
+	// y = sin(x)
+	ActivationSine goevo.Activation = "sine"
+	// y = e^(-x^2)
+	ActivationGaussian goevo.Activation = "gaussian"
+)
+
+// The activations that a hidden neuron can mutate between
+var hiddenActivations = []goevo.Activation{
+	goevo.ActivationSigmoid,
+	goevo.ActivationTanh,
+	goevo.ActivationReLU,
+	ActivationStep,
+	ActivationSine,
+	ActivationGaussian,
+}
+
+var activationFuncs = map[goevo.Activation](func(float64) float64){
+	goevo.ActivationLinear: func(x float64) float64 { return x },
+	goevo.ActivationReLU:   func(x float64) float64 { return math.Max(x, 0) },
+	goevo.ActivationTanh:   math.Tanh,
+	goevo.ActivationReLn: func(x float64) float64 {
+		if x < 0 {
+			return 0
+		}
+		return math.Log(x + 1)
+	},
+	goevo.ActivationSigmoid: func(x float64) float64 { return 1 / (1 + math.Exp(-x)) },
+	goevo.ActivationReLUMax: func(x float64) float64 { return math.Min(math.Max(x, 0), 1) },
+	ActivationStep: func(x float64) float64 {
+		if x > 0 {
+			return 1
+		}
+		return 0
+	},
+	ActivationSine:     math.Sin,
+	ActivationGaussian: func(x float64) float64 { return math.Exp(-x * x) },
+}
+
+// A compiled genotype, the same as a goevo.Phenotype but supporting our extra activations
+type Brain struct {
+	memory         []float64
+	values         []float64
+	activations    [](func(float64) float64)
+	conns          [][]goevo.PhenotypeConnection
+	recurrentConns [][]goevo.RecurrentPhenotypeConnection
+	numIn          int
+	numOut         int
+}
+
+// Create a brain from genotype `g`. Unknown activations are treated as linear
+func NewBrain(g *goevo.Genotype) *Brain {
+	mem := make([]float64, len(g.NeuronOrder))
+	acts := make([](func(float64) float64), len(g.NeuronOrder))
+	for n, nid := range g.NeuronOrder {
+		if f, ok := activationFuncs[g.Neurons[nid].Activation]; ok {
+			acts[n] = f
+		} else {
+			acts[n] = activationFuncs[goevo.ActivationLinear]
+		}
+	}
+	conns, recurrentConns := orderedConnections(g)
+	return &Brain{
+		memory:         mem,
+		values:         make([]float64, len(mem)),
+		activations:    acts,
+		conns:          conns,
+		recurrentConns: recurrentConns,
+		numIn:          g.NumIn,
+		numOut:         g.NumOut,
+	}
+}
+
+// Do a forward pass, taking into account any memory left over from recurrent connections
+func (b *Brain) Forward(inputs []float64) []float64 {
+	if len(inputs) != b.numIn {
+		panic("not correct number of inputs")
+	}
+	for i := 0; i < b.numIn; i++ {
+		b.memory[i] += inputs[i]
+	}
+	for ni := range b.memory {
+		b.memory[ni] = b.activations[ni](b.memory[ni])
+		for _, c := range b.conns[ni] {
+			b.memory[c.To] += c.Weight * b.memory[ni]
+		}
+	}
+	copy(b.values, b.memory)
+	output := make([]float64, b.numOut)
+	copy(output, b.memory[len(b.memory)-b.numOut:])
+	for ni := range b.memory {
+		b.memory[ni] = 0
+		for _, c := range b.recurrentConns[ni] {
+			b.memory[ni] += b.memory[c.From] * c.Weight
+		}
+	}
+	return output
+}
+
+// The value of each neuron (in execution order) after the last forward pass
+func (b *Brain) Values() []float64 {
+	return b.values
+}
+
+// Change the activation of a random hidden neuron of `g` to a different one from `hiddenActivations`
+func MutateRandomActivation(g *goevo.Genotype) {
+	_, numHidden, _ := g.Topology()
+	if numHidden == 0 {
+		return
+	}
+	n := g.Neurons[g.NeuronOrder[g.NumIn+rand.Intn(numHidden)]]
+	for {
+		a := hiddenActivations[rand.Intn(len(hiddenActivations))]
+		if a != n.Activation {
+			n.Activation = a
+			return
+		}
+	}
+}
+
+// Remove every hidden neuron of `g` that can never affect the output of the brain, along with its synapses.
+// These are the neurons that cannot reach an output, and the neurons that no input reaches that always stay at 0.
+// A neuron that no input reaches but whose activation is not 0 at 0, such as a sigmoid, acts as a bias, so it is kept. Returns the number of neurons removed
+func PruneDeadNeurons(g *goevo.Genotype) int {
+	// Find which neurons are reachable from the inputs, and which can reach the outputs
+	fromInputs := make(map[int]bool)
+	toOutputs := make(map[int]bool)
+	for nid, n := range g.Neurons {
+		fromInputs[nid] = n.Type == goevo.NeuronInput
+		toOutputs[nid] = n.Type == goevo.NeuronOutput
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, s := range g.Synapses {
+			if fromInputs[s.From] && !fromInputs[s.To] {
+				fromInputs[s.To] = true
+				changed = true
+			}
+			if toOutputs[s.To] && !toOutputs[s.From] {
+				toOutputs[s.From] = true
+				changed = true
+			}
+		}
+	}
+	// A neuron that no input reaches is silent if it is 0 at 0 and only silent neurons feed it, as then it stays at 0 forever.
+	// Start with every such neuron that is 0 at 0, and take away the ones fed by neurons that are not silent until none change
+	silent := make(map[int]bool)
+	for nid, n := range g.Neurons {
+		if !fromInputs[nid] {
+			f, ok := activationFuncs[n.Activation]
+			silent[nid] = !ok || f(0) == 0
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, s := range g.Synapses {
+			if silent[s.To] && !silent[s.From] {
+				silent[s.To] = false
+				changed = true
+			}
+		}
+	}
+	// Remove the dead neurons and their synapses
+	removed := 0
+	for nid, n := range g.Neurons {
+		if n.Type == goevo.NeuronHidden && (!toOutputs[nid] || silent[nid]) {
+			for sid, s := range g.Synapses {
+				if s.From == nid || s.To == nid {
+					delete(g.Synapses, sid)
+				}
+			}
+			delete(g.Neurons, nid)
+			removed++
+		}
+	}
+	if removed > 0 {
+		order := make([]int, 0, len(g.Neurons))
+		for _, nid := range g.NeuronOrder {
+			if g.IsNeuron(nid) {
+				order = append(order, nid)
+			}
+		}
+		g.NeuronOrder = order
+		g.InverseNeuronOrder = make(map[int]int)
+		for i, nid := range order {
+			g.InverseNeuronOrder[nid] = i
+		}
+	}
+	return removed
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/JoshPattman/goevo"
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// Handle the user's input to edit the brain of `c` in the brain panel drawn by `view` inside `bounds`.
+// All new neurons and synapses get their innovation ids from the global counter, and the creature's brain is rebuilt after every edit
+func updateBrainEditor(win *pixelgl.Window, c *Creature, view *BrainView, bounds pixel.Rect) {
+	g := c.DNA.Genotype
+	changed := false
+	selectedNeuron, selectedSynapse := view.SelectedNeuron, view.SelectedSynapse
+
+	// Select neurons and synapses by clicking them, or connect two neurons by clicking one then the other
+	if win.JustPressed(pixelgl.MouseButtonLeft) && bounds.Contains(win.MousePosition()) {
+		if nid, ok := view.NeuronAt(bounds, win.MousePosition()); ok {
+			if g.IsNeuron(selectedNeuron) && selectedNeuron != nid {
+				sid, err := g.AddSynapse(gtCounter, selectedNeuron, nid, 1)
+				if err != nil {
+					fmt.Println(err)
+				} else {
+					changed = true
+					selectedNeuron, selectedSynapse = -1, sid
+				}
+			} else if selectedNeuron == nid {
+				selectedNeuron = -1
+			} else {
+				selectedNeuron, selectedSynapse = nid, -1
+			}
+		} else if sid, ok := view.SynapseAt(bounds, win.MousePosition()); ok {
+			selectedNeuron, selectedSynapse = -1, sid
+		} else {
+			selectedNeuron, selectedSynapse = -1, -1
+		}
+	}
+
+	// Edit the selected synapse
+	if s, ok := g.Synapses[selectedSynapse]; ok {
+		if justPressedOrRepeated(win, pixelgl.KeyEqual) || justPressedOrRepeated(win, pixelgl.KeyKPAdd) {
+			s.Weight += 0.1
+			changed = true
+		}
+		if justPressedOrRepeated(win, pixelgl.KeyMinus) || justPressedOrRepeated(win, pixelgl.KeyKPSubtract) {
+			s.Weight -= 0.1
+			changed = true
+		}
+		if win.JustPressed(pixelgl.KeyDelete) || win.JustPressed(pixelgl.KeyBackspace) {
+			// This also removes any hidden neurons that are left without inputs or outputs
+			g.PruneSynapse(selectedSynapse)
+			selectedSynapse = -1
+			changed = true
+		} else if win.JustPressed(pixelgl.KeyH) {
+			nid, _, err := g.AddNeuron(gtCounter, selectedSynapse, goevo.ActivationSigmoid)
+			if err != nil {
+				fmt.Println(err)
+			} else {
+				selectedNeuron, selectedSynapse = nid, -1
+				changed = true
+			}
+		}
+	}
+
+	// Edit the selected neuron
+	if n, ok := g.Neurons[selectedNeuron]; ok && n.Type == goevo.NeuronHidden && win.JustPressed(pixelgl.KeyV) {
+		for i, a := range hiddenActivations {
+			if a == n.Activation || i == len(hiddenActivations)-1 {
+				n.Activation = hiddenActivations[(i+1)%len(hiddenActivations)]
+				break
+			}
+		}
+		changed = true
+	}
+
+	if changed {
+		c.RebuildBrain()
+		view.SetGenotype(g, c.InputNames(), creatureOutputNames)
+	}
+	view.SelectedNeuron, view.SelectedSynapse = selectedNeuron, selectedSynapse
+}
+
+func justPressedOrRepeated(win *pixelgl.Window, b pixelgl.Button) bool {
+	return win.JustPressed(b) || win.Repeated(b)
+}
+
+// Describe the current selection of the brain editor
+func brainEditorSelectionInfo(c *Creature, view *BrainView) string {
+	g := c.DNA.Genotype
+	if s, ok := g.Synapses[view.SelectedSynapse]; ok {
+		return fmt.Sprintf("Synapse #%d: %d -> %d, weight %.2f", view.SelectedSynapse, s.From, s.To, s.Weight)
+	}
+	if n, ok := g.Neurons[view.SelectedNeuron]; ok {
+		return fmt.Sprintf("Neuron #%d: %s, %s", view.SelectedNeuron, n.Type, n.Activation)
+	}
+	return "Nothing selected"
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/JoshPattman/goevo"
+)
+
+// Go source for the body of each activation function, in terms of `x`
+var activationGoSource = map[goevo.Activation]string{
+	goevo.ActivationLinear:  "return x",
+	goevo.ActivationReLU:    "if x < 0 {\nreturn 0\n}\nreturn x",
+	goevo.ActivationTanh:    "return math.Tanh(x)",
+	goevo.ActivationReLn:    "if x < 0 {\nreturn 0\n}\nreturn math.Log(x + 1)",
+	goevo.ActivationSigmoid: "return 1 / (1 + math.Exp(-x))",
+	goevo.ActivationReLUMax: "if x < 0 {\nreturn 0\n}\nif x > 1 {\nreturn 1\n}\nreturn x",
+	ActivationStep:          "if x > 0 {\nreturn 1\n}\nreturn 0",
+	ActivationSine:          "return math.Sin(x)",
+	ActivationGaussian:      "return math.Exp(-x * x)",
+}
+
+// Write the genotype `g` as a Graphviz DOT graph, with inputs and outputs labelled by `inputNames` and `outputNames`
+func BrainToDOT(g *goevo.Genotype, inputNames, outputNames []string) string {
+	b := &bytes.Buffer{}
+	numIn, numHidden, numOut := g.Topology()
+	fmt.Fprintln(b, "digraph brain {")
+	fmt.Fprintln(b, "\trankdir=LR;")
+	fmt.Fprintln(b, "\tnode [style=filled, fontname=\"monospace\"];")
+	fmt.Fprintln(b, "\t{\n\t\trank=source;")
+	for i := 0; i < numIn; i++ {
+		nid := g.NeuronOrder[i]
+		fmt.Fprintf(b, "\t\tn%d [label=%s, shape=box, fillcolor=%s];\n", nid, strconv.Quote(nameOrDefault(inputNames, i, "input")), dotColor(neuronColor(g.Neurons[nid])))
+	}
+	fmt.Fprintln(b, "\t}")
+	for i := 0; i < numHidden; i++ {
+		nid := g.NeuronOrder[numIn+i]
+		label := fmt.Sprintf("%s\\n#%d", g.Neurons[nid].Activation, nid)
+		fmt.Fprintf(b, "\tn%d [label=\"%s\", shape=ellipse, fillcolor=%s];\n", nid, label, dotColor(neuronColor(g.Neurons[nid])))
+	}
+	fmt.Fprintln(b, "\t{\n\t\trank=sink;")
+	for i := 0; i < numOut; i++ {
+		nid := g.NeuronOrder[numIn+numHidden+i]
+		fmt.Fprintf(b, "\t\tn%d [label=%s, shape=box, fillcolor=%s];\n", nid, strconv.Quote(nameOrDefault(outputNames, i, "output")), dotColor(neuronColor(g.Neurons[nid])))
+	}
+	fmt.Fprintln(b, "\t}")
+	for _, sid := range sortedKeys(g.Synapses) {
+		s := g.Synapses[sid]
+		isRecurrent := g.InverseNeuronOrder[s.From] >= g.InverseNeuronOrder[s.To]
+		style := "solid"
+		if isRecurrent {
+			style = "dashed"
+		}
+		penWidth := math.Max(math.Min(math.Abs(s.Weight), 1)*3, 0.5)
+		fmt.Fprintf(b, "\tn%d -> n%d [label=\"%.3f\", color=%s, penwidth=%.2f, style=%s, constraint=%t, tooltip=\"synapse #%d\"];\n",
+			s.From, s.To, s.Weight, dotColor(synapseColor(s.Weight, isRecurrent)), penWidth, style, !isRecurrent, sid)
+	}
+	fmt.Fprintln(b, "}")
+	return b.String()
+}
+
+// Generate a standalone Go file in package `packageName` that computes the same outputs as a Brain made from `g`.
+// The generated code has no dependencies other than the standard library
+func BrainToGo(g *goevo.Genotype, packageName string, inputNames, outputNames []string) (string, error) {
+	b := &bytes.Buffer{}
+	numIn, numHidden, numOut := g.Topology()
+	numNeurons := len(g.NeuronOrder)
+
+	// Work out which activations we need
+	usedActivations := make([]goevo.Activation, 0)
+	usesMath := false
+	for _, nid := range g.NeuronOrder {
+		a := g.Neurons[nid].Activation
+		if _, ok := activationGoSource[a]; !ok {
+			return "", fmt.Errorf("cannot generate code for activation '%s'", a)
+		}
+		if !containsActivation(usedActivations, a) {
+			usedActivations = append(usedActivations, a)
+			usesMath = usesMath || bytes.Contains([]byte(activationGoSource[a]), []byte("math."))
+		}
+	}
+
+	fmt.Fprintln(b, "// Code generated by ocean from a creature brain. DO NOT EDIT.")
+	fmt.Fprintln(b)
+	fmt.Fprintf(b, "package %s\n\n", packageName)
+	if usesMath {
+		fmt.Fprintln(b, "import \"math\"")
+		fmt.Fprintln(b)
+	}
+	fmt.Fprintf(b, "const (\nNumInputs = %d\nNumOutputs = %d\n)\n\n", numIn, numOut)
+	fmt.Fprintln(b, "// Inputs:")
+	for i := 0; i < numIn; i++ {
+		fmt.Fprintf(b, "//   %d: %s\n", i, nameOrDefault(inputNames, i, "input"))
+	}
+	fmt.Fprintln(b, "//")
+	fmt.Fprintln(b, "// Outputs:")
+	for i := 0; i < numOut; i++ {
+		fmt.Fprintf(b, "//   %d: %s\n", i, nameOrDefault(outputNames, i, "output"))
+	}
+	fmt.Fprintln(b, "//")
+	fmt.Fprintln(b, "// Brain holds the memory carried between calls to Forward by recurrent synapses.")
+	fmt.Fprintln(b, "// The zero value is ready to use.")
+	fmt.Fprintf(b, "type Brain struct {\nm [%d]float64\n}\n\n", numNeurons)
+
+	// The forward pass, unrolled in execution order
+	fmt.Fprintln(b, "// Forward computes the outputs of the brain from its inputs.")
+	fmt.Fprintln(b, "func (b *Brain) Forward(inputs [NumInputs]float64) [NumOutputs]float64 {")
+	fmt.Fprintln(b, "m := &b.m")
+	fmt.Fprintln(b, "for i := range inputs {\nm[i] += inputs[i]\n}")
+	conns, recurrentConns := orderedConnections(g)
+	for ni, nid := range g.NeuronOrder {
+		fmt.Fprintf(b, "m[%d] = %s(m[%d]) // neuron #%d\n", ni, g.Neurons[nid].Activation, ni, nid)
+		for _, c := range conns[ni] {
+			fmt.Fprintf(b, "m[%d] += %s * m[%d]\n", c.To, goFloat(c.Weight), ni)
+		}
+	}
+	fmt.Fprintln(b, "var out [NumOutputs]float64")
+	fmt.Fprintf(b, "copy(out[:], m[%d:])\n", numIn+numHidden)
+	for ni := range g.NeuronOrder {
+		fmt.Fprintf(b, "m[%d] = 0\n", ni)
+		for _, c := range recurrentConns[ni] {
+			fmt.Fprintf(b, "m[%d] += m[%d] * %s\n", ni, c.From, goFloat(c.Weight))
+		}
+	}
+	fmt.Fprintln(b, "return out\n}")
+
+	for _, a := range usedActivations {
+		fmt.Fprintf(b, "\nfunc %s(x float64) float64 {\n%s\n}\n", a, activationGoSource[a])
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return "", err
+	}
+	return string(src), nil
+}
+
+// A Go package name made from `name`, keeping only its lower case letters and digits, such as "brain1700000000" for "brain_1700000000"
+func goPackageName(name string) string {
+	b := strings.Builder{}
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9' && b.Len() > 0) {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "brain"
+	}
+	return b.String()
+}
+
+// The forward and recurrent connections of `g`, indexed by neuron order, in the same layout as a Brain
+func orderedConnections(g *goevo.Genotype) ([][]goevo.PhenotypeConnection, [][]goevo.RecurrentPhenotypeConnection) {
+	conns := make([][]goevo.PhenotypeConnection, len(g.NeuronOrder))
+	recurrentConns := make([][]goevo.RecurrentPhenotypeConnection, len(g.NeuronOrder))
+	for _, sid := range sortedKeys(g.Synapses) {
+		s := g.Synapses[sid]
+		fromOrder := g.InverseNeuronOrder[s.From]
+		toOrder := g.InverseNeuronOrder[s.To]
+		if fromOrder < toOrder {
+			conns[fromOrder] = append(conns[fromOrder], goevo.PhenotypeConnection{To: toOrder, Weight: s.Weight})
+		} else {
+			recurrentConns[toOrder] = append(recurrentConns[toOrder], goevo.RecurrentPhenotypeConnection{From: fromOrder, Weight: s.Weight})
+		}
+	}
+	return conns, recurrentConns
+}
+
+func nameOrDefault(names []string, i int, prefix string) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return fmt.Sprintf("%s %d", prefix, i)
+}
+
+func containsActivation(as []goevo.Activation, a goevo.Activation) bool {
+	for _, a2 := range as {
+		if a2 == a {
+			return true
+		}
+	}
+	return false
+}
+
+func goFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if f < 0 {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func dotColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("\"#%02x%02x%02x\"", r>>8, g>>8, b>>8)
+}
+
+// The keys of `m` in ascending order, so that exports are the same each time
+func sortedKeys[T any](m map[int]T) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+
+	"github.com/JoshPattman/goevo"
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+var (
+	inputNeuronColor  = colornames.Green
+	outputNeuronColor = colornames.Yellow
+)
+
+// The colour of a hidden neuron with each activation
+var activationColors = map[goevo.Activation]color.RGBA{
+	goevo.ActivationSigmoid: colornames.Magenta,
+	goevo.ActivationTanh:    colornames.Orangered,
+	goevo.ActivationReLU:    colornames.Cyan,
+	ActivationStep:          colornames.White,
+	ActivationSine:          colornames.Deepskyblue,
+	ActivationGaussian:      colornames.Lime,
+}
+
+// The horizontal positions of the input and output columns in the view. Labels go outside of these
+const (
+	brainViewInputX  = 0.25
+	brainViewOutputX = 0.8
+)
+
+// Draws a genotype as a network of neurons and synapses inside a rectangle of the screen.
+// If given the values of a running brain, neurons are coloured by their value and synapses by the signal they carry
+type BrainView struct {
+	NeuronSize      float64
+	SelectedNeuron  int // The id of the highlighted neuron, or -1 for none
+	SelectedSynapse int // The id of the highlighted synapse, or -1 for none
+	genotype        *goevo.Genotype
+	positions       map[int]pixel.Vec // Neuron positions, where (0,0) is the bottom left of the view and (1,1) is the top right
+	inputNames      []string
+	outputNames     []string
+	legend          *text.Text
+	labels          *text.Text
+}
+
+func NewBrainView(atlas *text.Atlas) *BrainView {
+	return &BrainView{
+		NeuronSize:      5,
+		SelectedNeuron:  -1,
+		SelectedSynapse: -1,
+		positions:       make(map[int]pixel.Vec),
+		legend:          text.New(pixel.ZV, atlas),
+		labels:          text.New(pixel.ZV, atlas),
+	}
+}
+
+// Set the genotype to draw, along with the names of its inputs and outputs, and recalculate the layout of its neurons
+func (v *BrainView) SetGenotype(g *goevo.Genotype, inputNames, outputNames []string) {
+	v.genotype = g
+	v.SelectedNeuron = -1
+	v.SelectedSynapse = -1
+	v.inputNames = inputNames
+	v.outputNames = outputNames
+	v.positions = make(map[int]pixel.Vec)
+	numIn, numHidden, numOut := g.Topology()
+	for i := 0; i < numIn; i++ {
+		v.positions[g.NeuronOrder[i]] = pixel.V(brainViewInputX, 1-paddedPosition(i, numIn))
+	}
+	for i := 0; i < numOut; i++ {
+		v.positions[g.NeuronOrder[numIn+numHidden+i]] = pixel.V(brainViewOutputX, 1-paddedPosition(i, numOut))
+	}
+	for i := 0; i < numHidden; i++ {
+		nid := g.NeuronOrder[numIn+i]
+		// Place the neuron at the average height of the neurons that feed into it, with a little jitter so they dont overlap
+		y, n := 0.0, 0.0
+		for _, s := range g.Synapses {
+			if p, ok := v.positions[s.From]; ok && s.To == nid {
+				y += p.Y
+				n++
+			}
+		}
+		if n == 0 {
+			y, n = 0.5, 1
+		}
+		jitter := (rand.New(rand.NewSource(int64(nid))).Float64() - 0.5) * 0.1
+		x := brainViewInputX + (brainViewOutputX-brainViewInputX)*float64(i+1)/float64(numHidden+1)
+		v.positions[nid] = pixel.V(x, y/n+jitter)
+	}
+
+	// List the activations used by this brain
+	v.legend.Clear()
+	for _, a := range hiddenActivations {
+		for _, n := range g.Neurons {
+			if n.Type == goevo.NeuronHidden && n.Activation == a {
+				v.legend.Color = activationColors[a]
+				fmt.Fprintln(v.legend, a)
+				break
+			}
+		}
+	}
+}
+
+// Draw the brain onto `t` inside `bounds`.
+// `values` are the neuron values of a running brain in execution order, and may be nil to draw the genotype alone
+func (v *BrainView) Draw(t pixel.Target, imd *imdraw.IMDraw, bounds pixel.Rect, values []float64) {
+	if v.genotype == nil {
+		return
+	}
+	g := v.genotype
+	if len(values) != len(g.NeuronOrder) {
+		values = nil
+	}
+	value := func(nid int) float64 {
+		if values == nil {
+			return 0
+		}
+		return values[g.InverseNeuronOrder[nid]]
+	}
+	toScreen := func(p pixel.Vec) pixel.Vec {
+		return v.toScreen(bounds, p)
+	}
+
+	imd.Clear()
+	if s, ok := g.Synapses[v.SelectedSynapse]; ok {
+		imd.Color = colornames.White
+		imd.Push(toScreen(v.positions[s.From]), toScreen(v.positions[s.To]))
+		imd.Line(7)
+	}
+	if _, ok := g.Neurons[v.SelectedNeuron]; ok {
+		imd.Color = colornames.White
+		imd.Push(toScreen(v.positions[v.SelectedNeuron]))
+		imd.Circle(v.NeuronSize+3, 0)
+	}
+	for _, s := range g.Synapses {
+		isRecurrent := g.InverseNeuronOrder[s.From] >= g.InverseNeuronOrder[s.To]
+		strength := s.Weight
+		if values != nil {
+			strength *= value(s.From)
+		}
+		col := synapseColor(strength, isRecurrent)
+		if values != nil {
+			// Fade out synapses that are not carrying much signal
+			col = lerpColor(colornames.Dimgray, col, math.Min(math.Abs(strength), 1))
+		}
+		imd.Color = col
+		imd.Push(toScreen(v.positions[s.From]), toScreen(v.positions[s.To]))
+		imd.Line(math.Max(math.Min(math.Abs(strength), 1)*3, 1))
+	}
+	for nid, n := range g.Neurons {
+		p := toScreen(v.positions[nid])
+		imd.Color = neuronColor(n)
+		imd.Push(p)
+		imd.Circle(v.NeuronSize, 0)
+		if values != nil {
+			imd.Color = neuronValueColor(value(nid))
+			imd.Push(p)
+			imd.Circle(v.NeuronSize-2, 0)
+		}
+	}
+	imd.Draw(t)
+
+	// Label the inputs and outputs
+	v.labels.Clear()
+	numIn, numHidden, _ := g.Topology()
+	for i, name := range v.inputNames {
+		if i >= numIn {
+			break
+		}
+		p := toScreen(v.positions[g.NeuronOrder[i]])
+		v.labels.Dot = pixel.V(p.X-v.NeuronSize-4-v.labels.BoundsOf(name).W(), p.Y-v.labels.LineHeight/3)
+		fmt.Fprint(v.labels, name)
+	}
+	for i, name := range v.outputNames {
+		if numIn+numHidden+i >= len(g.NeuronOrder) {
+			break
+		}
+		p := toScreen(v.positions[g.NeuronOrder[numIn+numHidden+i]])
+		v.labels.Dot = pixel.V(p.X+v.NeuronSize+4, p.Y-v.labels.LineHeight/3)
+		fmt.Fprint(v.labels, name)
+	}
+	v.labels.Draw(t, pixel.IM)
+	v.legend.Draw(t, pixel.IM.Moved(pixel.V(bounds.Min.X+5, bounds.Max.Y-v.legend.LineHeight)))
+}
+
+// The id of the neuron drawn at the screen position `p`, when the brain is drawn inside `bounds`
+func (v *BrainView) NeuronAt(bounds pixel.Rect, p pixel.Vec) (int, bool) {
+	for nid, pos := range v.positions {
+		if v.toScreen(bounds, pos).To(p).Len() <= v.NeuronSize+1 {
+			return nid, true
+		}
+	}
+	return -1, false
+}
+
+// The id of the synapse drawn closest to the screen position `p`, when the brain is drawn inside `bounds`
+func (v *BrainView) SynapseAt(bounds pixel.Rect, p pixel.Vec) (int, bool) {
+	if v.genotype == nil {
+		return -1, false
+	}
+	best, bestDist := -1, 4.0
+	for sid, s := range v.genotype.Synapses {
+		a, b := v.toScreen(bounds, v.positions[s.From]), v.toScreen(bounds, v.positions[s.To])
+		if d := pointToSegmentDist(p, a, b); d < bestDist {
+			best, bestDist = sid, d
+		}
+	}
+	return best, best != -1
+}
+
+func (v *BrainView) toScreen(bounds pixel.Rect, p pixel.Vec) pixel.Vec {
+	return bounds.Min.Add(pixel.V(p.X*bounds.W(), p.Y*bounds.H()))
+}
+
+func pointToSegmentDist(p, a, b pixel.Vec) float64 {
+	ab := b.Sub(a)
+	if ab.Len() == 0 {
+		return p.To(a).Len()
+	}
+	t := math.Max(0, math.Min(1, p.Sub(a).Dot(ab)/ab.Dot(ab)))
+	return p.To(a.Add(ab.Scaled(t))).Len()
+}
+
+func neuronColor(n *goevo.Neuron) color.RGBA {
+	switch n.Type {
+	case goevo.NeuronInput:
+		return inputNeuronColor
+	case goevo.NeuronOutput:
+		return outputNeuronColor
+	}
+	if c, ok := activationColors[n.Activation]; ok {
+		return c
+	}
+	return colornames.Gray
+}
+
+// Positive values go from black to white, negative values go from black to red
+func neuronValueColor(v float64) color.RGBA {
+	if v >= 0 {
+		return lerpColor(colornames.Black, colornames.White, math.Min(v, 1))
+	}
+	return lerpColor(colornames.Black, colornames.Red, math.Min(-v, 1))
+}
+
+func synapseColor(w float64, isRecurrent bool) color.RGBA {
+	if w > 0 {
+		if isRecurrent {
+			return colornames.Lime
+		}
+		return colornames.Blue
+	}
+	if isRecurrent {
+		return colornames.Yellow
+	}
+	return colornames.Red
+}
+
+// Evenly spaces `max` items between 0.1 and 0.9, returning the position of the `n`th
+func paddedPosition(n, max int) float64 {
+	if max == 1 {
+		return 0.5
+	}
+	return 0.1 + 0.8*float64(n)/float64(max-1)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/faiface/mainthread"
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// pixelgl does not give access to the clipboard, so go straight to glfw.
+// These hand the call to the main thread themselves, so they must be called from inside the function given to pixelgl.Run once a window is open,
+// and never from inside mainthread.Call (which would deadlock) or from a command line tool such as `code`, where glfw is not running
+
+func getClipboardText() string {
+	return mainthread.CallVal(func() interface{} {
+		return glfw.GetClipboardString()
+	}).(string)
+}
+
+func setClipboardText(s string) {
+	mainthread.Call(func() {
+		glfw.SetClipboardString(s)
+	})
+}
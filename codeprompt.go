@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/faiface/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+// A prompt for pasting in a creature code. While it is open, it takes all keyboard input
+type CodePrompt struct {
+	isOpen bool
+	input  string
+	err    error
+	text   *text.Text
+}
+
+func NewCodePrompt(atlas *text.Atlas) *CodePrompt {
+	return &CodePrompt{
+		text: text.New(pixel.ZV, atlas),
+	}
+}
+
+func (p *CodePrompt) IsOpen() bool {
+	return p.isOpen
+}
+
+func (p *CodePrompt) Open() {
+	p.isOpen = true
+	p.input = ""
+	p.err = nil
+}
+
+// Handle the keyboard input for this frame. If a valid code was entered, its DNA is returned
+func (p *CodePrompt) Update(win *pixelgl.Window) (CreatureDNA, bool) {
+	p.input = updateTextInput(win, p.input)
+	if win.JustPressed(pixelgl.KeyEscape) {
+		p.isOpen = false
+	} else if win.JustPressed(pixelgl.KeyEnter) || win.JustPressed(pixelgl.KeyKPEnter) {
+		dna, err := DecodeCreatureCode(p.input)
+		if err != nil {
+			p.err = err
+			return CreatureDNA{}, false
+		}
+		p.isOpen = false
+		return dna, true
+	}
+	return CreatureDNA{}, false
+}
+
+func (p *CodePrompt) Instructions() string {
+	return "Type Or (Ctrl+V) Paste A Creature Code, (Enter) To Spawn It, (Esc) To Cancel"
+}
+
+// Draw the prompt in the middle of the window
+func (p *CodePrompt) Draw(win *pixelgl.Window, imd *imdraw.IMDraw) {
+	if !p.isOpen {
+		return
+	}
+	p.text.Clear()
+	p.text.Color = colornames.White
+	fmt.Fprintf(p.text, "Import Creature Code\n\n")
+	// Codes are long, so wrap them to fit on the screen
+	lineLength := int(win.Bounds().W()*0.8) / 7
+	code := p.input + "_"
+	for len(code) > lineLength {
+		fmt.Fprintln(p.text, code[:lineLength])
+		code = code[lineLength:]
+	}
+	fmt.Fprintln(p.text, code)
+	if p.err != nil {
+		p.text.Color = colornames.Red
+		fmt.Fprintf(p.text, "\n%v", p.err)
+	}
+
+	bounds := p.text.Bounds()
+	loc := win.Bounds().Center().Sub(bounds.Center())
+	imd.Clear()
+	imd.Color = color.RGBA{0, 0, 0, 200}
+	panel := bounds.Moved(loc)
+	panel = pixel.R(panel.Min.X-10, panel.Min.Y-10, panel.Max.X+10, panel.Max.Y+10)
+	corners := panel.Vertices()
+	imd.Push(corners[:]...)
+	imd.Polygon(0)
+	imd.Draw(win)
+	p.text.Draw(win, pixel.IM.Moved(loc))
+}
+
+// Apply this frame's typing to `s`. Typed characters are added, backspace removes the last character, and ctrl+v pastes from the clipboard
+func updateTextInput(win *pixelgl.Window, s string) string {
+	s += win.Typed()
+	if justPressedOrRepeated(win, pixelgl.KeyBackspace) && len(s) > 0 {
+		runes := []rune(s)
+		s = string(runes[:len(runes)-1])
+	}
+	isCtrl := win.Pressed(pixelgl.KeyLeftControl) || win.Pressed(pixelgl.KeyRightControl) || win.Pressed(pixelgl.KeyLeftSuper) || win.Pressed(pixelgl.KeyRightSuper)
+	if isCtrl && win.JustPressed(pixelgl.KeyV) {
+		s += strings.TrimSpace(getClipboardText())
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A tool that can be run from the command line instead of the game, with `ocean <name> [args...]`
+type command struct {
+	usage       string
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"analyse": {
+		usage:       "analyse [flags] <dna file>",
+		description: "Find out which sensors a creature uses by ablating each of its brain inputs",
+		run:         analyseCommand,
+	},
+	"play": {
+		usage:       "play [-seed path]... [-count n] [-spawn mode] [-random n]",
+		description: "Start the game with a world seeded from population archives, DNA files or directories of DNA files",
+		run:         playCommand,
+	},
+	"diff": {
+		usage:       "diff [-json] [-c1 n] [-c2 n] [-c3 n] <dna a> <dna b>",
+		description: "Compare two creatures (DNA files or creature codes): traits, synapses and neurons by innovation id, and compatibility distance",
+		run:         diffCommand,
+	},
+	"tournament": {
+		usage:       "tournament [flags] <dna file> <dna file>...",
+		description: "Play creatures against each other in seeded matches and rank them by win rate and Elo",
+		run:         tournamentCommand,
+	},
+	"scenario": {
+		usage:       "scenario <scenario file>",
+		description: "Start the game in a scenario, with its own map, parameters, creatures, food and goal",
+		run:         scenarioCommand,
+	},
+	"headless": {
+		usage:       "headless [-duration s] [-seed n] [-sample s] [-params file] [-export] [-o file]",
+		description: "Run the simulation without a window, writing samples of the population (and of any params with a timeline) to a CSV file",
+		run:         headlessCommand,
+	},
+	"map": {
+		usage:       "map [-seed n] [-name name]",
+		description: "Generate a map from the params and save its walls and plants as PNGs to edit and load with wall_image and plant_image",
+		run:         mapCommand,
+	},
+	"code": {
+		usage:       "code [-d] [-o file] [-library name] <dna file or creature code>",
+		description: "Print a creature code for a DNA file to share in chat, or with -d turn a creature code back into DNA",
+		run:         codeCommand,
+	},
+}
+
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		printCommandsHelp()
+		if name == "help" || name == "-h" || name == "--help" {
+			return nil
+		}
+		return fmt.Errorf("unknown command '%s'", name)
+	}
+	return cmd.run(args)
+}
+
+func printCommandsHelp() {
+	fmt.Println("Usage: ocean [command]")
+	fmt.Println("Run with no command to start the game. Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %s\n      %s\n", commands[name].usage, commands[name].description)
+	}
+}
@@ -18,6 +18,12 @@ func (c *SaveLoadCounter) SafeWith(gt *goevo.Genotype) {
 			max = id
 		}
 	}
+	// Synapses share the same ids as neurons
+	for id := range gt.Synapses {
+		if id > max {
+			max = id
+		}
+	}
 	if max >= c.c {
 		c.c = max + 1
 	}
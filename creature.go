@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
 
@@ -20,24 +21,20 @@ type Creature struct {
 	debugAnimalSensorValues []float64
 	debugWallSensorValues   []float64
 	sensorAngles            []float64
-	phenotype               *goevo.Phenotype
+	phenotype               *Brain
 	updateTimer             float64
 	nnOutput                []float64
+	inputHook               func(inputs []float64) // If set, called with the brain inputs before each brain update, and may modify them
+	possessedOutput         []float64              // If set, used instead of the output of the brain
 }
 
 func NewCreature(dna CreatureDNA) *Creature {
 	dna = dna.Validated()
-	sa := make([]float64, 0)
-	visionAngle := math.Pi
-	numSensors := 5.0
-	anglePerSensor := visionAngle / (numSensors - 1)
-	for a := -visionAngle / 2; a <= visionAngle/2; a += anglePerSensor {
-		sa = append(sa, a)
-	}
+	sa := creatureSensorAngles()
 
-	var pheno *goevo.Phenotype
+	var pheno *Brain
 	if dna.Genotype != nil {
-		pheno = goevo.NewPhenotype(dna.Genotype)
+		pheno = NewBrain(dna.Genotype)
 	}
 	return &Creature{
 		Pos:          pixel.V(0, 0),
@@ -64,10 +61,46 @@ func (c *Creature) Eq(o HashMappable) bool {
 	return c.Pos == o.(*Creature).Pos
 }
 
+// The shortest distance a creature can see, even in pitch dark water
+const minCreatureSight = 1.0
+
+// The angles of a creature's sensor rays, relative to the way it is facing
+func creatureSensorAngles() []float64 {
+	sa := make([]float64, 0)
+	visionAngle := math.Pi
+	numSensors := 5.0
+	anglePerSensor := visionAngle / (numSensors - 1)
+	for a := -visionAngle / 2; a <= visionAngle/2; a += anglePerSensor {
+		sa = append(sa, a)
+	}
+	return sa
+}
+
 func (c *Creature) NumInputs() int {
-	return len(c.sensorAngles)*3 + 2 + 1
+	return len(c.sensorAngles)*3 + 4 + 1
+}
+
+// The names of each brain input, in the order they are given to the brain
+func (c *Creature) InputNames() []string {
+	return creatureInputNames()
 }
 
+// The names of each brain input of every creature, in the order they are given to the brain.
+// Saved creatures record these, so that their brains can be adapted if the inputs change
+func creatureInputNames() []string {
+	sa := creatureSensorAngles()
+	names := make([]string, 0, len(sa)*3+5)
+	for _, sensor := range []string{"food", "animal", "wall"} {
+		for i := range sa {
+			names = append(names, fmt.Sprintf("%s %d", sensor, i))
+		}
+	}
+	return append(names, "depth", "alignment", "temperature mismatch", "time of day", "bias")
+}
+
+// The names of each brain output, in the order the brain gives them
+var creatureOutputNames = []string{"turn", "power", "attack"}
+
 func (c *Creature) Die(e *Environment) {
 	e.Creatures.Remove(c)
 	f := NewFood(c.Energy, false)
@@ -76,22 +109,41 @@ func (c *Creature) Die(e *Environment) {
 	e.Food.Add(f)
 }
 
+// Recompile the brain from the genotype, so that edits to the genotype take effect
+func (c *Creature) RebuildBrain() {
+	c.phenotype = NewBrain(c.DNA.Genotype)
+}
+
+// The energy the creature is using per second where it is now, which is the metabolism from its DNA multiplied by the cost of being in water of the wrong temperature
+func (c *Creature) CurrentMetabolism(e *Environment) float64 {
+	return c.DNA.Metabolism() * c.DNA.TemperatureMetabolismMultiplier(e.Temperature.At(c.Pos, e.SimTime.Seconds()))
+}
+
 func (c *Creature) Fwd() pixel.Vec {
 	return pixel.V(0, 1).Rotated(c.Rot)
 }
 
 func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 	// Update knowlege
-	sight := c.DNA.VisionRange()
-	neighbors := e.Creatures.Query(c.Pos, sight)
+	// Darker water limits how far we can see, unless what we are looking at glows
+	// However dark it is, we can still sense things right next to us, which also keeps the sensor maths from dividing by zero
+	fullSight := c.DNA.VisionRange()
+	sight := math.Max(fullSight*e.LightAt(c.Pos), minCreatureSight)
+	neighbors := e.Creatures.Query(c.Pos, math.Max(fullSight, sight))
 	nearbyFood := e.Food.Query(c.Pos, sight)
 	// We just leave this as 10 because visibility does not make a difference to drag due to plants
 	nearbyPlants := e.Plants.Query(c.Pos, 10)
-	currentDepth := c.Pos.Len() / float64(e.Radius)
-	currentDepthAlignment := c.Fwd().Dot(c.Pos.Unit())
+	currentDepth := e.Depth(c.Pos)
+	// A torus has no deeper direction to face
+	currentDepthAlignment := 0.0
+	if !e.Wraps() {
+		currentDepthAlignment = c.Fwd().Dot(c.Pos.Unit())
+	}
+	// Positive when the water is hotter than we would like, and negative when it is colder
+	temperatureMismatch := e.Temperature.At(c.Pos, e.SimTime.Seconds()) - c.DNA.PreferredTemperature
 
 	// Update non physical attributes
-	c.Energy -= deltaTime * c.DNA.Metabolism()
+	c.Energy -= deltaTime * c.CurrentMetabolism(e)
 	if c.Energy <= c.DNA.DeathEnergy() {
 		c.Die(e)
 		return
@@ -99,7 +151,7 @@ func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 
 	// Eat food if we are touching within an angle
 	for _, f := range nearbyFood {
-		offset := c.Pos.Sub(f.Pos)
+		offset := e.To(f.Pos, c.Pos)
 		if offset.Len() < (c.Radius+f.Radius())/2 {
 			if -offset.Unit().Dot(c.Fwd()) > 0.9 { // On mouth
 				// Take energy from food
@@ -117,7 +169,7 @@ func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 			}
 			// Push the food away
 			lenDiff := offset.Len() - (c.Radius+f.Radius())/2
-			f.Pos = f.Pos.Add(offset.Unit().Scaled(15 * deltaTime * lenDiff))
+			f.Pos = e.WrapPos(f.Pos.Add(offset.Unit().Scaled(15 * deltaTime * lenDiff)))
 		}
 	}
 	if c.Energy > c.DNA.MaxEnergy() {
@@ -157,12 +209,15 @@ func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 		}
 	}
 
+	// Get pushed by the current, which drags the creature along at the speed of the water
+	resultantForce = resultantForce.Add(e.Currents.At(c.Pos, e.SimTime.Seconds()).Scaled(drag))
+
 	// Bounce off neighbors
 	neighborsOnMouth := make([]*Creature, 0)
 	{
 		neighborBounceForce := pixel.ZV
 		for _, n := range neighbors {
-			diff := c.Pos.Sub(n.Pos)
+			diff := e.To(n.Pos, c.Pos)
 			if n != c && diff.Len() < (c.Radius+n.Radius)/2 {
 				overlap := diff.Len() - (c.Radius+n.Radius)/2
 				neighborBounceForce = neighborBounceForce.Add(diff.Unit().Scaled(-overlap * 50))
@@ -176,7 +231,7 @@ func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 
 	// Check if we are touching a plant, and add drag if we are
 	for _, p := range nearbyPlants {
-		offset := c.Pos.Sub(p.Pos)
+		offset := e.To(p.Pos, c.Pos)
 		if offset.Len() < (c.Radius+p.Radius)/2 {
 			drag += c.DNA.PlantDrag()
 			break
@@ -200,7 +255,7 @@ func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 			sensorWallDist := math.Inf(1)
 
 			// Check Wall sensors
-			sectionSamples := math.Round(sight * 2)
+			sectionSamples := math.Max(1, math.Round(sight*2))
 			sectionSampleLength := sight / sectionSamples
 			for i := 0.0; i <= sectionSamples; i++ {
 				dist := i * sectionSampleLength
@@ -214,7 +269,7 @@ func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 
 			// Check Food sensors
 			for _, f := range nearbyFood {
-				dirToFood := f.Pos.Sub(c.Pos)
+				dirToFood := e.To(c.Pos, f.Pos)
 				distToFood := dirToFood.Len()
 				dotSensorDir := dirToFood.Dot(sensorDir)
 				if distToFood < sensorWallDist-0.5 && dotSensorDir > 0 {
@@ -236,14 +291,15 @@ func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 			}
 			// Check Animal sensors
 			for _, f := range neighbors {
-				dirToAnimal := f.Pos.Sub(c.Pos)
+				dirToAnimal := e.To(c.Pos, f.Pos)
 				distToAnimal := dirToAnimal.Len()
 				dotSensorDir := dirToAnimal.Dot(sensorDir)
-				if distToAnimal < sensorWallDist-0.5 && dotSensorDir > 0 {
+				animalSight := math.Max(sight, fullSight*f.DNA.Glow())
+				if distToAnimal < sensorWallDist-0.5 && distToAnimal < animalSight && dotSensorDir > 0 {
 					allowedDistFromLine := math.Sin(sensorWidth) / 2 * distToAnimal
 					distToLine := math.Abs(dirToAnimal.Sub(sensorDir.Scaled(dotSensorDir)).Len())
 					if distToLine <= allowedDistFromLine {
-						newValue := 1 - distToAnimal/sight
+						newValue := 1 - distToAnimal/animalSight
 						if newValue > sensorAnimalValue {
 							sensorAnimalValue = newValue
 						}
@@ -267,9 +323,17 @@ func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 		nnInput = append(nnInput, sensorFoodValues...)
 		nnInput = append(nnInput, sensorAnimalValues...)
 		nnInput = append(nnInput, sensorWallValues...)
-		nnInput = append(nnInput, currentDepth, currentDepthAlignment)
+		nnInput = append(nnInput, currentDepth, currentDepthAlignment, temperatureMismatch, e.SunHeight())
 		nnInput = append(nnInput, 1)
-		c.nnOutput = c.phenotype.Forward(nnInput)
+		if c.inputHook != nil {
+			c.inputHook(nnInput)
+		}
+		if c.possessedOutput == nil {
+			c.nnOutput = c.phenotype.Forward(nnInput)
+		}
+	}
+	if c.possessedOutput != nil {
+		c.nnOutput = c.possessedOutput
 	}
 
 	// Parse the output
@@ -293,51 +357,80 @@ func (c *Creature) Update(deltaTime float64, e *Environment, updateBrain bool) {
 	c.Vel = c.Vel.Add(resultantForce.Scaled(deltaTime)).Scaled(1 - drag*deltaTime)
 	c.RotVel = (c.RotVel + resultantTorque*deltaTime) * (1 - GlobalSP.CreatureBaseMultipliers.AngularDrag*deltaTime)
 	// Update pos and rot
-	c.Pos = c.Pos.Add(c.Vel.Scaled(deltaTime))
+	c.Pos = e.WrapPos(c.Pos.Add(c.Vel.Scaled(deltaTime)))
 	c.Rot += c.RotVel * deltaTime //c.Vel.Angle() - math.Pi/2
 }
 
 func (c *Creature) Child() *Creature {
 	// Copy DNA
 	dna := c.DNA.Copied()
+	dna.Generation++
+	mp := c.DNA.MutationParameters()
+	// Mutate the mutation rates themselves
+	if mp.EvolveMutationRates {
+		mr := DefaultMutationGenes()
+		if dna.MutationRates != nil {
+			mr = *dna.MutationRates
+		}
+		mr = mr.Mutated(mp.MutationRateMutationSize)
+		dna.MutationRates = &mr
+	}
 	// Mutate traits
-	if rand.Float64() < GlobalSP.MutationParameters.TraitMutationRate {
-		dna.Diet += (rand.Float64()*2 - 1) * GlobalSP.MutationParameters.TraitMutationSize
+	if rand.Float64() < mp.TraitMutationRate {
+		dna.Diet += (rand.Float64()*2 - 1) * mp.TraitMutationSize
+	}
+	if rand.Float64() < mp.TraitMutationRate {
+		dna.PreferredTemperature += (rand.Float64()*2 - 1) * mp.TraitMutationSize
 	}
-	if rand.Float64() < GlobalSP.MutationParameters.TraitMutationRate {
-		dna.Size += (rand.Float64()*2 - 1) * GlobalSP.MutationParameters.TraitMutationSize
+	if rand.Float64() < mp.TraitMutationRate {
+		dna.Size += (rand.Float64()*2 - 1) * mp.TraitMutationSize
 	}
-	if rand.Float64() < GlobalSP.MutationParameters.TraitMutationRate {
-		dna.Speed += (rand.Float64()*2 - 1) * GlobalSP.MutationParameters.TraitMutationSize
+	if rand.Float64() < mp.TraitMutationRate {
+		dna.Speed += (rand.Float64()*2 - 1) * mp.TraitMutationSize
 	}
-	if rand.Float64() < GlobalSP.MutationParameters.TraitMutationRate {
-		dna.Vision += (rand.Float64()*2 - 1) * GlobalSP.MutationParameters.TraitMutationSize
+	if rand.Float64() < mp.TraitMutationRate {
+		dna.Vision += (rand.Float64()*2 - 1) * mp.TraitMutationSize
 	}
-	if rand.Float64() < GlobalSP.MutationParameters.TraitMutationRate {
-		dna.Color = c.DNA.Color.Randomised(GlobalSP.MutationParameters.TraitMutationSize)
+	if rand.Float64() < mp.TraitMutationRate {
+		dna.Color = c.DNA.Color.Randomised(mp.TraitMutationSize)
+	}
+	if GlobalSP.EnvironmentalParams.EnableBioluminescence && rand.Float64() < mp.TraitMutationRate {
+		dna.Bioluminescence += (rand.Float64()*2 - 1) * mp.TraitMutationSize
 	}
 	// Mutate brain
 	maxReps := 4.0
 	for i := 0; i < int(maxReps); i++ {
-		if rand.Float64() < GlobalSP.MutationParameters.SynapseMutationProbability/maxReps {
-			goevo.MutateRandomSynapse(dna.Genotype, GlobalSP.MutationParameters.SynapseMutationSize)
+		if rand.Float64() < mp.SynapseMutationProbability/maxReps {
+			goevo.MutateRandomSynapse(dna.Genotype, mp.SynapseMutationSize)
 		}
 	}
 	for i := 0; i < int(maxReps); i++ {
-		if rand.Float64() < GlobalSP.MutationParameters.SynapseGrowthProbability/maxReps {
-			goevo.AddRandomSynapse(gtCounter, dna.Genotype, GlobalSP.MutationParameters.SynapseGrowthSize, false, 5)
+		if rand.Float64() < mp.SynapseGrowthProbability/maxReps && (mp.MaxSynapses <= 0 || len(dna.Genotype.Synapses) < mp.MaxSynapses) {
+			goevo.AddRandomSynapse(gtCounter, dna.Genotype, mp.SynapseGrowthSize, false, 5)
 		}
 	}
 	for i := 0; i < int(maxReps); i++ {
-		if rand.Float64() < GlobalSP.MutationParameters.NeuronGrowProbability/maxReps {
+		_, numHidden, _ := dna.Genotype.Topology()
+		// Adding a neuron also adds a synapse
+		canGrow := (mp.MaxHiddenNeurons <= 0 || numHidden < mp.MaxHiddenNeurons) && (mp.MaxSynapses <= 0 || len(dna.Genotype.Synapses) < mp.MaxSynapses)
+		if rand.Float64() < mp.NeuronGrowProbability/maxReps && canGrow {
 			goevo.AddRandomNeuron(gtCounter, dna.Genotype, goevo.ActivationSigmoid)
 		}
 	}
 	for i := 0; i < int(maxReps); i++ {
-		if rand.Float64() < GlobalSP.MutationParameters.SynapsePruneProbability/maxReps {
+		if rand.Float64() < mp.ActivationMutationProbability/maxReps {
+			MutateRandomActivation(dna.Genotype)
+		}
+	}
+	for i := 0; i < int(maxReps); i++ {
+		if rand.Float64() < mp.SynapsePruneProbability/maxReps {
 			goevo.PruneRandomSynapse(dna.Genotype)
 		}
 	}
+	// Clean up the brain
+	if mp.PruneDeadNeurons {
+		PruneDeadNeurons(dna.Genotype)
+	}
 	// Create creture
 	c1 := NewCreature(dna)
 	return c1
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+
+	"github.com/aquilax/go-perlin"
+	"github.com/faiface/pixel"
+)
+
+// A slowly changing flow of water over the whole map, made from perlin noise.
+// The flow is the curl of the noise, so it forms swirls and streams instead of flowing into or out of points
+type CurrentField struct {
+	noise  *perlin.Perlin
+	period float64 // The distance the currents repeat over in x and y, or 0 if they do not repeat
+}
+
+func NewCurrentField(seed int64, period float64) *CurrentField {
+	return &CurrentField{
+		noise:  perlin.NewPerlin(1.8, 2, 3, seed),
+		period: period,
+	}
+}
+
+// The velocity of the water at `pos` at sim time `t` seconds
+func (cf *CurrentField) At(pos pixel.Vec, t float64) pixel.Vec {
+	ep := GlobalSP.EnvironmentalParams
+	if ep.CurrentStrength == 0 {
+		return pixel.ZV
+	}
+	scale := math.Max(ep.CurrentScale, 1)
+	z := t * ep.CurrentChangeRate
+	noise := func(x, y float64) float64 {
+		return cf.noise.Noise3D(x/scale, y/scale, z)
+	}
+	potential := noise
+	if cf.period > 0 {
+		potential = func(x, y float64) float64 {
+			return periodicNoise(noise, x, y, cf.period)
+		}
+	}
+	// Take the curl of the noise using finite differences
+	h := 0.01 * scale
+	dx := (potential(pos.X+h, pos.Y) - potential(pos.X-h, pos.Y)) / (2 * h / scale)
+	dy := (potential(pos.X, pos.Y+h) - potential(pos.X, pos.Y-h)) / (2 * h / scale)
+	return pixel.V(dy, -dx).Scaled(ep.CurrentStrength)
+}
+
+// Move every food with the current, unless that would move it into a wall
+func (e *Environment) driftFood(deltaTime float64) {
+	drift := GlobalSP.EnvironmentalParams.FoodCurrentDrift
+	if GlobalSP.EnvironmentalParams.CurrentStrength == 0 || drift == 0 {
+		return
+	}
+	t := e.SimTime.Seconds()
+	for _, f := range e.Food.Objects {
+		newPos := e.WrapPos(f.Pos.Add(e.Currents.At(f.Pos, t).Scaled(drift * deltaTime)))
+		if !e.sampleWallAt(newPos, false) {
+			f.Pos = newPos
+		}
+	}
+}
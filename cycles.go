@@ -0,0 +1,48 @@
+package main
+
+import "math"
+
+// How high the sun is, from -1 at midnight to 1 at midday. The sim starts at sunrise, and it is always midday if days are turned off
+func (e *Environment) SunHeight() float64 {
+	dayLength := GlobalSP.EnvironmentalParams.DayLength
+	if dayLength <= 0 {
+		return 1
+	}
+	return math.Sin(2 * math.Pi * e.SimTime.Seconds() / dayLength)
+}
+
+// How much of the sunlight reaches the water, from the night light level at midnight to 1 at midday
+func (e *Environment) Daylight() float64 {
+	night := math.Min(math.Max(GlobalSP.EnvironmentalParams.NightLight, 0), 1)
+	return night + (1-night)*(e.SunHeight()+1)/2
+}
+
+// Where we are in the year, from -1 in the middle of winter to 1 in the middle of summer. It is always spring if seasons are turned off
+func (e *Environment) Season() float64 {
+	seasonLength := GlobalSP.EnvironmentalParams.SeasonLength
+	if seasonLength <= 0 {
+		return 0
+	}
+	return math.Sin(2 * math.Pi * e.SimTime.Seconds() / seasonLength)
+}
+
+// How quickly plants grow food in the current season, compared to the growth set in the plant parameters
+func (e *Environment) SeasonalPlantGrowth() float64 {
+	return math.Max(1+GlobalSP.EnvironmentalParams.SeasonPlantVariation*e.Season(), 0)
+}
+
+// How quickly food decays in the current season, compared to the food decay rate
+func (e *Environment) SeasonalFoodDecay() float64 {
+	return math.Max(1+GlobalSP.EnvironmentalParams.SeasonDecayVariation*e.Season(), 0)
+}
+
+// The name of the current season, or an empty string if seasons are turned off
+func (e *Environment) SeasonName() string {
+	seasonLength := GlobalSP.EnvironmentalParams.SeasonLength
+	if seasonLength <= 0 {
+		return ""
+	}
+	// Each season is centred on the point of the year where it is strongest
+	phase := math.Mod(e.SimTime.Seconds()/seasonLength+0.125, 1)
+	return []string{"Spring", "Summer", "Autumn", "Winter"}[int(phase*4)%4]
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"math"
+	"math/rand"
+	"os"
 
 	"github.com/JoshPattman/goevo"
 )
@@ -14,13 +17,71 @@ type CreatureDNA struct {
 	Vision float64 `json:"vision"`
 
 	// Balances
-	Diet float64 `json:"diet"` // 0 = veggie, 1 = meat
+	Diet                 float64 `json:"diet"`                  // 0 = veggie, 1 = meat
+	PreferredTemperature float64 `json:"preferred_temperature"` // The water temperature the creature is best adapted to, from 0 (cold) to 1 (hot)
 
 	// Brain
 	Genotype *goevo.Genotype `json:"brain"`
 
 	// Cosmetic
 	Color ColorHSV `json:"color"`
+
+	// How brightly the creature glows, from 0 to 1. Only has an effect when bioluminescence is enabled
+	Bioluminescence float64 `json:"bioluminescence"`
+
+	// Mutation (optional, the global mutation parameters are used when this is missing)
+	MutationRates *MutationGenes `json:"mutation_rates,omitempty"`
+
+	// Lineage
+	Generation int `json:"generation"` // The number of births since this creature's line was seeded
+	Lineage    int `json:"lineage"`    // An id shared by every creature descended from the same seeded creature, or 0 if unknown
+}
+
+// The parts of the mutation parameters that a creature can carry and evolve itself
+type MutationGenes struct {
+	TraitMutationRate          float64 `json:"trait_mutation_rate"`
+	TraitMutationSize          float64 `json:"trait_mutation_size"`
+	SynapseMutationProbability float64 `json:"synapse_mutation_probability"`
+	SynapseMutationSize        float64 `json:"synapse_mutation_size"`
+}
+
+// Create mutation genes with the values of the global mutation parameters
+func DefaultMutationGenes() MutationGenes {
+	mp := GlobalSP.MutationParameters
+	return MutationGenes{
+		TraitMutationRate:          mp.TraitMutationRate,
+		TraitMutationSize:          mp.TraitMutationSize,
+		SynapseMutationProbability: mp.SynapseMutationProbability,
+		SynapseMutationSize:        mp.SynapseMutationSize,
+	}
+}
+
+// Returns a copy of the genes where each value has been scaled by a random log-normal factor
+func (m MutationGenes) Mutated(size float64) MutationGenes {
+	scale := func(v float64) float64 {
+		return v * math.Exp(rand.NormFloat64()*size)
+	}
+	return MutationGenes{
+		TraitMutationRate:          scale(m.TraitMutationRate),
+		TraitMutationSize:          scale(m.TraitMutationSize),
+		SynapseMutationProbability: scale(m.SynapseMutationProbability),
+		SynapseMutationSize:        scale(m.SynapseMutationSize),
+	}
+}
+
+// Returns a copy of the genes clamped to the bounds set by the global mutation parameters
+func (m MutationGenes) Bounded() MutationGenes {
+	mp := GlobalSP.MutationParameters
+	b := math.Max(mp.MutationRateBounds, 1)
+	clamp := func(v, global, max float64) float64 {
+		return math.Min(math.Max(v, global/b), math.Min(global*b, max))
+	}
+	return MutationGenes{
+		TraitMutationRate:          clamp(m.TraitMutationRate, mp.TraitMutationRate, 1),
+		TraitMutationSize:          clamp(m.TraitMutationSize, mp.TraitMutationSize, math.Inf(1)),
+		SynapseMutationProbability: clamp(m.SynapseMutationProbability, mp.SynapseMutationProbability, 1),
+		SynapseMutationSize:        clamp(m.SynapseMutationSize, mp.SynapseMutationSize, math.Inf(1)),
+	}
 }
 
 func (c CreatureDNA) MeatConversionEfficiency() float64 {
@@ -37,7 +98,35 @@ func (c CreatureDNA) MaxEnergy() float64 {
 }
 func (c CreatureDNA) Metabolism() float64 {
 	return GlobalSP.CreatureBaseMultipliers.Metabolism*(c.Size*c.Size+c.Vision+c.Speed)*c.PredatoryMetabolismMultiplier() +
-		GlobalSP.CreatureBaseMultipliers.MetabolismPerNeuron*float64(len(c.Genotype.NeuronOrder)-c.Genotype.NumIn-c.Genotype.NumOut)
+		c.BrainMetabolism() +
+		GlobalSP.EnvironmentalParams.BioluminescenceMetabolism*c.Glow()
+}
+
+// How much the metabolism is multiplied by in water of temperature `temp`, because of the difference from the preferred temperature
+func (c CreatureDNA) TemperatureMetabolismMultiplier(temp float64) float64 {
+	return 1 + GlobalSP.EnvironmentalParams.TemperatureMetabolism*math.Abs(temp-c.PreferredTemperature)
+}
+func (c CreatureDNA) BrainMetabolism() float64 {
+	_, numHidden, _ := c.Genotype.Topology()
+	numSynapses := len(c.Genotype.Synapses)
+	bm := GlobalSP.CreatureBaseMultipliers
+	return bm.MetabolismPerNeuron*c.weightedHiddenNeurons() +
+		bm.MetabolismPerNeuronSquared*float64(numHidden*numHidden) +
+		bm.MetabolismPerSynapse*float64(numSynapses) +
+		bm.MetabolismPerSynapseSquared*float64(numSynapses*numSynapses)
+}
+
+// The number of hidden neurons, with each one weighted by the metabolism multiplier of its activation
+func (c CreatureDNA) weightedHiddenNeurons() float64 {
+	total := 0.0
+	for _, nid := range c.Genotype.NeuronOrder[c.Genotype.NumIn : len(c.Genotype.NeuronOrder)-c.Genotype.NumOut] {
+		if m, ok := GlobalSP.CreatureBaseMultipliers.ActivationMetabolism[c.Genotype.Neurons[nid].Activation]; ok {
+			total += m
+		} else {
+			total += 1
+		}
+	}
+	return total
 }
 func (c CreatureDNA) FoodEatRate() float64 {
 	return GlobalSP.CreatureBaseMultipliers.FoodEatRate * c.Size
@@ -51,20 +140,74 @@ func (c CreatureDNA) DeathEnergy() float64 {
 func (c CreatureDNA) VisionRange() float64 {
 	return GlobalSP.CreatureBaseMultipliers.Vision * c.Vision
 }
+
+// How brightly the creature glows, or 0 if bioluminescence is disabled.
+// A glowing creature can be seen from this fraction of the full vision range of others, however dark the water is
+func (c CreatureDNA) Glow() float64 {
+	if !GlobalSP.EnvironmentalParams.EnableBioluminescence {
+		return 0
+	}
+	return c.Bioluminescence
+}
 func (c CreatureDNA) PushForce() float64 {
 	return GlobalSP.CreatureBaseMultipliers.PushForce * c.Speed
 }
 
+// The mutation parameters used when making a child of this creature.
+// If the creature carries its own mutation genes and they are enabled, they replace the global values.
+func (c CreatureDNA) MutationParameters() MutationParameters {
+	mp := GlobalSP.MutationParameters
+	if mp.EvolveMutationRates && c.MutationRates != nil {
+		mp.TraitMutationRate = c.MutationRates.TraitMutationRate
+		mp.TraitMutationSize = c.MutationRates.TraitMutationSize
+		mp.SynapseMutationProbability = c.MutationRates.SynapseMutationProbability
+		mp.SynapseMutationSize = c.MutationRates.SynapseMutationSize
+	}
+	return mp
+}
+
 func (c CreatureDNA) Validated() CreatureDNA {
 	newDNA := c
 	newDNA.Diet = math.Min(math.Max(c.Diet, 0), 1)
+	newDNA.PreferredTemperature = math.Min(math.Max(c.PreferredTemperature, 0), 1)
 	newDNA.Size = math.Max(c.Size, 0.1)
 	newDNA.Speed = math.Max(c.Speed, 0.1)
+	newDNA.Bioluminescence = math.Min(math.Max(c.Bioluminescence, 0), 1)
+	if c.MutationRates != nil {
+		mr := c.MutationRates.Bounded()
+		newDNA.MutationRates = &mr
+	}
 	return newDNA
 }
 
 func (c CreatureDNA) Copied() CreatureDNA {
 	newDNA := c
 	newDNA.Genotype = goevo.NewGenotypeCopy(c.Genotype)
+	if c.MutationRates != nil {
+		mr := *c.MutationRates
+		newDNA.MutationRates = &mr
+	}
 	return newDNA
 }
+
+// Read a creature's DNA from a JSON file
+func LoadDNAFile(path string) (CreatureDNA, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CreatureDNA{}, err
+	}
+	var dna CreatureDNA
+	if err := json.Unmarshal(data, &dna); err != nil {
+		return CreatureDNA{}, err
+	}
+	return dna, nil
+}
+
+// Write a creature's DNA to a JSON file
+func SaveDNAFile(path string, dna CreatureDNA) error {
+	data, err := json.MarshalIndent(dna, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/JoshPattman/goevo"
+)
+
+// The version of the DNA file format that this build writes.
+// Version 0 is the format used before DNA files had a version, which did not record the names of the brain inputs.
+// Version 1 adds the `format_version` and `input_names` fields.
+// Version 2 renames the `temperature` input to `temperature mismatch`, as it is the difference from the preferred temperature
+const DNAFormatVersion = 2
+
+// The brain inputs that creatures had when DNA files had no version
+var unversionedInputNames = []string{
+	"food 0", "food 1", "food 2", "food 3", "food 4",
+	"animal 0", "animal 1", "animal 2", "animal 3", "animal 4",
+	"wall 0", "wall 1", "wall 2", "wall 3", "wall 4",
+	"depth", "alignment", "bias",
+}
+
+// Each migration upgrades the fields of a DNA file from the version it is indexed by to the next version
+var dnaMigrations = []func(fields map[string]json.RawMessage) error{
+	// 0 -> 1
+	func(fields map[string]json.RawMessage) error {
+		names, err := json.Marshal(unversionedInputNames)
+		if err != nil {
+			return err
+		}
+		fields["input_names"] = names
+		return nil
+	},
+	// 1 -> 2
+	func(fields map[string]json.RawMessage) error {
+		names := make([]string, 0)
+		if raw, ok := fields["input_names"]; ok {
+			if err := json.Unmarshal(raw, &names); err != nil {
+				return fmt.Errorf("invalid input_names: %v", err)
+			}
+		}
+		for i, name := range names {
+			if name == "temperature" {
+				names[i] = "temperature mismatch"
+			}
+		}
+		renamed, err := json.Marshal(names)
+		if err != nil {
+			return err
+		}
+		fields["input_names"] = renamed
+		return nil
+	},
+}
+
+// The fields that every DNA file must have, after migrating it to the current version
+var requiredDNAFields = []string{"size", "speed", "vision", "diet", "brain", "color", "input_names"}
+
+// The DNA as it is written to a file, along with the information needed to upgrade it later
+type dnaFile struct {
+	FormatVersion int      `json:"format_version"`
+	InputNames    []string `json:"input_names"`
+	dnaFields
+}
+
+// CreatureDNA without its JSON methods, so that they do not call themselves
+type dnaFields CreatureDNA
+
+func (c CreatureDNA) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dnaFile{
+		FormatVersion: DNAFormatVersion,
+		InputNames:    creatureInputNames(),
+		dnaFields:     dnaFields(c),
+	})
+}
+
+// Read DNA written by any version of the game, upgrading it to the current format.
+// Returns an error that says what is wrong if the DNA is invalid
+func (c *CreatureDNA) UnmarshalJSON(data []byte) error {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	version := 0
+	if raw, ok := fields["format_version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return fmt.Errorf("invalid format_version: %v", err)
+		}
+	}
+	if version < 0 || version > DNAFormatVersion {
+		return fmt.Errorf("DNA has format version %d, but this version of the game can only read up to version %d", version, DNAFormatVersion)
+	}
+	for ; version < DNAFormatVersion; version++ {
+		if err := dnaMigrations[version](fields); err != nil {
+			return fmt.Errorf("could not upgrade DNA from format version %d: %v", version, err)
+		}
+	}
+	for _, name := range requiredDNAFields {
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("DNA is missing the '%s' field", name)
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	f := dnaFile{}
+	f.Genotype = goevo.NewGenotypeEmpty()
+	// Creatures saved before temperature was added are most comfortable in the middle of the range
+	f.PreferredTemperature = 0.5
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	if f.Genotype == nil {
+		return errors.New("DNA has an empty brain")
+	}
+	if err := validateGenotype(f.Genotype, len(f.InputNames)); err != nil {
+		return fmt.Errorf("invalid brain: %v", err)
+	}
+	if err := adaptGenotypeInputs(f.Genotype, f.InputNames, creatureInputNames()); err != nil {
+		return fmt.Errorf("could not adapt brain to the current inputs: %v", err)
+	}
+	dna := CreatureDNA(f.dnaFields)
+	if err := dna.validateTraits(); err != nil {
+		return err
+	}
+	*c = dna
+	return nil
+}
+
+// Check that the traits of the DNA are usable numbers
+func (c CreatureDNA) validateTraits() error {
+	traits := map[string]float64{
+		"size": c.Size, "speed": c.Speed, "vision": c.Vision, "diet": c.Diet,
+		"preferred_temperature": c.PreferredTemperature,
+		"color.h":               c.Color.H, "color.s": c.Color.S, "color.v": c.Color.V,
+		"bioluminescence": c.Bioluminescence,
+	}
+	if c.MutationRates != nil {
+		traits["mutation_rates.trait_mutation_rate"] = c.MutationRates.TraitMutationRate
+		traits["mutation_rates.trait_mutation_size"] = c.MutationRates.TraitMutationSize
+		traits["mutation_rates.synapse_mutation_probability"] = c.MutationRates.SynapseMutationProbability
+		traits["mutation_rates.synapse_mutation_size"] = c.MutationRates.SynapseMutationSize
+	}
+	names := make([]string, 0, len(traits))
+	for name := range traits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if v := traits[name]; math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%s is %v, but must be a finite number", name, v)
+		}
+	}
+	return nil
+}
+
+// Check that `g` is a well formed brain with `numInputs` inputs and the same outputs as a creature.
+// The inverse neuron order is rebuilt from the neuron order, as it only duplicates it
+func validateGenotype(g *goevo.Genotype, numInputs int) error {
+	if g.NumIn != numInputs {
+		return fmt.Errorf("brain has %d inputs, but %d input names are listed", g.NumIn, numInputs)
+	}
+	if g.NumOut != len(creatureOutputNames) {
+		return fmt.Errorf("brain has %d outputs, but creatures have %d", g.NumOut, len(creatureOutputNames))
+	}
+	if len(g.NeuronOrder) != len(g.Neurons) {
+		return fmt.Errorf("neuron order lists %d neurons, but there are %d", len(g.NeuronOrder), len(g.Neurons))
+	}
+	g.InverseNeuronOrder = make(map[int]int)
+	for i, nid := range g.NeuronOrder {
+		n, ok := g.Neurons[nid]
+		if !ok || n == nil {
+			return fmt.Errorf("neuron order contains neuron %d, which does not exist", nid)
+		}
+		if _, ok := g.InverseNeuronOrder[nid]; ok {
+			return fmt.Errorf("neuron %d is in the neuron order more than once", nid)
+		}
+		g.InverseNeuronOrder[nid] = i
+		expectedType := goevo.NeuronHidden
+		if i < g.NumIn {
+			expectedType = goevo.NeuronInput
+		} else if i >= len(g.NeuronOrder)-g.NumOut {
+			expectedType = goevo.NeuronOutput
+		}
+		if n.Type != expectedType {
+			return fmt.Errorf("neuron %d is at position %d of the neuron order, so should be %s but is %s", nid, i, expectedType, n.Type)
+		}
+		if _, ok := activationFuncs[n.Activation]; !ok {
+			return fmt.Errorf("neuron %d has unknown activation '%s'", nid, n.Activation)
+		}
+	}
+	for _, sid := range sortedKeys(g.Synapses) {
+		s := g.Synapses[sid]
+		if s == nil {
+			return fmt.Errorf("synapse %d is empty", sid)
+		}
+		if !g.IsNeuron(s.From) || !g.IsNeuron(s.To) {
+			return fmt.Errorf("synapse %d connects neurons %d and %d, which do not both exist", sid, s.From, s.To)
+		}
+		if g.IsNeuron(sid) {
+			return fmt.Errorf("synapse %d has the same id as a neuron", sid)
+		}
+		if math.IsNaN(s.Weight) || math.IsInf(s.Weight, 0) {
+			return fmt.Errorf("synapse %d has weight %v, but must be a finite number", sid, s.Weight)
+		}
+	}
+	return nil
+}
+
+// Change the inputs of `g` from `oldNames` to `newNames`.
+// Inputs are matched by name, so inputs that still exist keep their synapses. Inputs that no longer exist are removed along with their synapses,
+// and new inputs are added without any synapses
+func adaptGenotypeInputs(g *goevo.Genotype, oldNames, newNames []string) error {
+	if len(oldNames) == len(newNames) {
+		same := true
+		for i := range oldNames {
+			same = same && oldNames[i] == newNames[i]
+		}
+		if same {
+			return nil
+		}
+	}
+	oldInputs := make(map[string]int)
+	for i, name := range oldNames {
+		if _, ok := oldInputs[name]; ok {
+			return fmt.Errorf("input '%s' is listed more than once", name)
+		}
+		oldInputs[name] = g.NeuronOrder[i]
+	}
+	// New inputs take their ids from the global counter, so that they cannot clash with the innovation ids of other creatures
+	gtCounter.SafeWith(g)
+
+	inputs := make([]int, 0, len(newNames))
+	for _, name := range newNames {
+		if nid, ok := oldInputs[name]; ok {
+			inputs = append(inputs, nid)
+			delete(oldInputs, name)
+		} else {
+			nid := gtCounter.Next()
+			g.Neurons[nid] = &goevo.Neuron{Type: goevo.NeuronInput, Activation: goevo.ActivationLinear}
+			inputs = append(inputs, nid)
+		}
+	}
+	for _, nid := range oldInputs {
+		for sid, s := range g.Synapses {
+			if s.From == nid || s.To == nid {
+				delete(g.Synapses, sid)
+			}
+		}
+		delete(g.Neurons, nid)
+	}
+	g.NeuronOrder = append(inputs, g.NeuronOrder[g.NumIn:]...)
+	g.NumIn = len(newNames)
+	g.InverseNeuronOrder = make(map[int]int)
+	for i, nid := range g.NeuronOrder {
+		g.InverseNeuronOrder[nid] = i
+	}
+	if len(g.NeuronOrder) != len(g.Neurons) {
+		return errors.New("brain inputs could not be matched up")
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/JoshPattman/goevo"
+)
+
+// Make a brain with an input for each of `names`, and a synapse from the input `from` to the first output with `weight`
+func newTestGenotype(names []string, from string, weight float64) *goevo.Genotype {
+	g := goevo.NewGenotype(gtCounter, len(names), len(creatureOutputNames), goevo.ActivationLinear, goevo.ActivationTanh)
+	for i, name := range names {
+		if name == from {
+			g.Synapses[gtCounter.Next()] = &goevo.Synapse{From: g.NeuronOrder[i], To: g.NeuronOrder[len(names)], Weight: weight}
+		}
+	}
+	return g
+}
+
+// Write DNA with the brain `g` as a DNA file of `version` with `names` as its inputs. A version of 0 leaves out the version and the input names
+func testDNAFile(t *testing.T, g *goevo.Genotype, version int, names []string) map[string]interface{} {
+	dna := NewRandomDNA()
+	dna.Genotype = g
+	data, err := json.Marshal(dna)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	delete(fields, "format_version")
+	delete(fields, "input_names")
+	if version > 0 {
+		fields["format_version"] = version
+		fields["input_names"] = names
+	}
+	return fields
+}
+
+func decodeTestDNA(t *testing.T, fields map[string]interface{}) (CreatureDNA, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dna CreatureDNA
+	err = json.Unmarshal(data, &dna)
+	return dna, err
+}
+
+// The inputs that the version 1 format had, where the temperature input had its old name
+func version1InputNames() []string {
+	names := creatureInputNames()
+	for i, name := range names {
+		if name == "temperature mismatch" {
+			names[i] = "temperature"
+		}
+	}
+	return names
+}
+
+func TestDNAMigrations(t *testing.T) {
+	cases := []struct {
+		name     string
+		version  int
+		names    []string
+		from     string // The input of the old brain with a synapse
+		expected string // The input of the upgraded brain that the synapse should now come from
+	}{
+		{"version 0", 0, unversionedInputNames, "depth", "depth"},
+		{"version 1 renames temperature", 1, version1InputNames(), "temperature", "temperature mismatch"},
+		{"version 1 keeps other inputs", 1, version1InputNames(), "wall 2", "wall 2"},
+		{"version 2", 2, creatureInputNames(), "bias", "bias"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gtCounter = &SaveLoadCounter{}
+			old := newTestGenotype(tc.names, tc.from, 0.5)
+			fields := testDNAFile(t, old, tc.version, tc.names)
+			// Ids given out to other creatures after this one was saved must not be reused for its new inputs
+			for i := 0; i < 100; i++ {
+				gtCounter.Next()
+			}
+			issued := gtCounter.c
+
+			dna, err := decodeTestDNA(t, fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g := dna.Genotype
+			current := creatureInputNames()
+			if g.NumIn != len(current) {
+				t.Fatalf("brain has %d inputs, expected %d", g.NumIn, len(current))
+			}
+			if err := validateGenotype(g, len(current)); err != nil {
+				t.Fatal(err)
+			}
+			for i, name := range current {
+				nid := g.NeuronOrder[i]
+				if _, ok := old.Neurons[nid]; !ok && nid <= issued {
+					t.Errorf("new input '%s' has id %d, which may already belong to another creature", name, nid)
+				}
+				hasSynapse := false
+				for _, s := range g.Synapses {
+					if s.From == nid {
+						hasSynapse = true
+						if name == tc.expected && s.Weight != 0.5 {
+							t.Errorf("synapse from '%s' has weight %v, expected 0.5", name, s.Weight)
+						}
+					}
+				}
+				if hasSynapse != (name == tc.expected) {
+					t.Errorf("input '%s' has a synapse: %v, expected %v", name, hasSynapse, name == tc.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestDNAFileErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		edit    func(fields map[string]interface{})
+		wantErr string
+	}{
+		{"wrong input count", func(fields map[string]interface{}) {
+			fields["input_names"] = append(creatureInputNames(), "extra")
+		}, "input names are listed"},
+		{"missing field", func(fields map[string]interface{}) {
+			delete(fields, "speed")
+		}, "missing the 'speed' field"},
+		{"newer version", func(fields map[string]interface{}) {
+			fields["format_version"] = DNAFormatVersion + 1
+		}, "can only read up to version"},
+		{"duplicate input", func(fields map[string]interface{}) {
+			names := creatureInputNames()
+			names[1] = names[0]
+			fields["input_names"] = names
+		}, "listed more than once"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gtCounter = &SaveLoadCounter{}
+			names := creatureInputNames()
+			fields := testDNAFile(t, newTestGenotype(names, "bias", 1), DNAFormatVersion, names)
+			tc.edit(fields)
+			_, err := decodeTestDNA(t, fields)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, expected one containing '%s'", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateGenotype(t *testing.T) {
+	cases := []struct {
+		name    string
+		edit    func(g *goevo.Genotype) int // Returns the number of inputs to validate against
+		wantErr string
+	}{
+		{"valid", func(g *goevo.Genotype) int {
+			return g.NumIn
+		}, ""},
+		{"wrong input count", func(g *goevo.Genotype) int {
+			return g.NumIn + 1
+		}, "input names are listed"},
+		{"wrong output count", func(g *goevo.Genotype) int {
+			g.NumOut++
+			return g.NumIn
+		}, "outputs, but creatures have"},
+		{"NaN weight", func(g *goevo.Genotype) int {
+			for _, s := range g.Synapses {
+				s.Weight = math.NaN()
+			}
+			return g.NumIn
+		}, "must be a finite number"},
+		{"infinite weight", func(g *goevo.Genotype) int {
+			for _, s := range g.Synapses {
+				s.Weight = math.Inf(1)
+			}
+			return g.NumIn
+		}, "must be a finite number"},
+		{"missing neuron", func(g *goevo.Genotype) int {
+			for _, s := range g.Synapses {
+				s.To = -1
+			}
+			return g.NumIn
+		}, "do not both exist"},
+		{"unknown activation", func(g *goevo.Genotype) int {
+			g.Neurons[g.NeuronOrder[0]].Activation = "wobble"
+			return g.NumIn
+		}, "unknown activation"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gtCounter = &SaveLoadCounter{}
+			g := newTestGenotype(creatureInputNames(), "bias", 1)
+			err := validateGenotype(g, tc.edit(g))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("got error %v, expected none", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, expected one containing '%s'", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"image"
+	"fmt"
 	"image/color"
 	"math"
 	"math/rand"
@@ -13,69 +13,92 @@ import (
 )
 
 type Environment struct {
-	TexelsWall [][]bool
-	Food       *HashMap[*Food]
-	Creatures  *HashMap[*Creature]
-	Radius     int
-	Plants     *HashMap[*Plant]
+	TexelsWall  *WallGrid
+	Food        *HashMap[*Food]
+	Creatures   *HashMap[*Creature]
+	Radius      int
+	Shape       string // The shape of the map, which is one of the map shape constants
+	Plants      *HashMap[*Plant]
+	SimTime     time.Duration
+	Currents    *CurrentField
+	Temperature *TemperatureField
 }
 
 func NewEnvironment(radius int) *Environment {
+	// Start from the values the timeline gives at the start of the sim
+	GlobalSP.ApplyTimeline(0)
+	shape, err := parseMapShape(GlobalSP.MapParams.Shape)
+	if err != nil {
+		fmt.Println(err)
+	}
 	env := &Environment{
 		TexelsWall: nil,
 		Radius:     radius,
+		Shape:      shape,
 		Food:       NewHashMap[*Food](10),
 		Creatures:  NewHashMap[*Creature](10),
 		Plants:     NewHashMap[*Plant](10),
 	}
 	env.regenerateTerrain()
 	env.regrowPlants()
+	// Things near one edge of a torus can see and touch things near the opposite edge
+	if env.Wraps() {
+		env.Food.SetWrap(float64(radius * 2))
+		env.Creatures.SetWrap(float64(radius * 2))
+		env.Plants.SetWrap(float64(radius * 2))
+	}
+	// The currents and temperature repeat across the edges of a torus so that there is no seam
+	period := 0.0
+	if env.Wraps() {
+		period = float64(radius * 2)
+	}
+	env.Currents = NewCurrentField(rand.Int63(), period)
+	env.Temperature = NewTemperatureField(rand.Int63(), radius, shape)
 	return env
 }
 
 func (env *Environment) regenerateTerrain() {
-	radius := env.Radius
-	radiusFloat := float64(radius)
-	tw := make([][]bool, radius*2)
-	perlinGen := perlin.NewPerlin(1.8, 2, 3, time.Now().UnixNano())
-	center := pixel.V(radiusFloat, radiusFloat)
-	for i := range tw {
-		tw[i] = make([]bool, radius*2)
-		for j := range tw[i] {
-			xc, yc := float64(i), float64(j)
-			p := perlinGen.Noise2D(xc/(25*GlobalSP.MapParams.CaveSize), yc/(25*GlobalSP.MapParams.CaveSize))
-			d := center.Sub(pixel.V(float64(i), float64(j))).Len()
-			if d < 0.25*radiusFloat {
-				tw[i][j] = false
-			} else if d < 0.5*radiusFloat {
-				tw[i][j] = p > 0.3
-			} else if d < 0.75*radiusFloat {
-				tw[i][j] = p > 0.1
-			} else if d < radiusFloat-2 {
-				tw[i][j] = p > 0.0
-			} else if d < radiusFloat {
-				tw[i][j] = true
-			} else {
-				tw[i][j] = true
-			}
+	if path := GlobalSP.MapParams.WallImage; path != "" {
+		tw, err := LoadWallImage(path, env.Radius)
+		if err == nil {
+			env.TexelsWall = tw
+			return
 		}
+		fmt.Println(err)
+	}
+	gen, err := NewTerrainGenerator(GlobalSP.MapParams)
+	if err != nil {
+		fmt.Println(err)
+		gen = PerlinTerrain{CaveSize: GlobalSP.MapParams.CaveSize}
 	}
-	env.TexelsWall = tw
+	env.TexelsWall = gen.Generate(env.Radius, env.Shape)
 }
 
 func (env *Environment) regrowPlants() {
+	if path := GlobalSP.MapParams.PlantImage; path != "" {
+		err := env.LoadPlantImage(path, GlobalSP.MapParams.PlantDensity*GlobalSP.MapParams.PlantImageDensity)
+		if err == nil {
+			return
+		}
+		fmt.Println(err)
+	}
 	env.Plants = NewHashMap[*Plant](10)
-	perlinGen := perlin.NewPerlin(1.8, 2, 3, time.Now().UnixNano())
-	fertilityPerlin := perlin.NewPerlin(1.8, 2, 3, time.Now().UnixNano())
+	perlinGen := perlin.NewPerlin(1.8, 2, 3, rand.Int63())
+	fertilityPerlin := perlin.NewPerlin(1.8, 2, 3, rand.Int63())
 	radiusFloat := float64(env.Radius)
 	for x := -radiusFloat; x < radiusFloat; x += 1 {
 		for y := -radiusFloat; y < radiusFloat; y += 1 {
 			p := pixel.V(x, y)
 			if !env.sampleWallAt(p, true) {
-				// Only if this is a free space with some distance to the side
+				// Only if this is a free space with some distance to the side.
+				// The noise only ever lowers the chance of a plant, so it is not worked out where no plant could grow, which saves a lot of time on big maps
+				chance := rand.Float64()
+				if chance >= GlobalSP.MapParams.PlantDensity {
+					continue
+				}
 				densityMult := perlinGen.Noise2D(p.X/100, p.Y/100)/2 + 0.5
 				densityMult = math.Pow(densityMult, 1/(1-GlobalSP.MapParams.PlantCoverage))
-				if rand.Float64() < GlobalSP.MapParams.PlantDensity*densityMult {
+				if chance < GlobalSP.MapParams.PlantDensity*densityMult {
 					env.Plants.Add(&Plant{
 						Pos:       p,
 						Radius:    3 + rand.Float64()*2,
@@ -90,32 +113,96 @@ func (env *Environment) regrowPlants() {
 	env.Plants.Refresh()
 }
 
-func (env *Environment) GetTerrainSprite() *pixel.Sprite {
-	img := image.NewRGBA(image.Rect(0, 0, len(env.TexelsWall), len(env.TexelsWall[0])))
-	for i := range env.TexelsWall {
-		for j := range env.TexelsWall[i] {
-			jImg := len(env.TexelsWall[i]) - j - 1
-			if env.TexelsWall[i][j] {
-				img.Set(i, jImg, colornames.Black)
-			} else {
-				d := pixel.V(float64(i), float64(j)).Sub(pixel.V(float64(env.Radius), float64(env.Radius))).Len() / float64(env.Radius)
-				if d >= 1 {
-					img.Set(i, jImg, color.RGBA{0, 0, 0, 0})
-				} else {
-					img.Set(i, jImg, lerpColor(colornames.Skyblue, color.RGBA{28, 40, 90, 255}, d))
-				}
+// Step the simulation forward by `deltaTime` seconds
+func (env *Environment) Update(deltaTime float64) {
+	// Change the parameters that have a timeline
+	GlobalSP.ApplyTimeline(env.SimTime.Seconds())
+	// Child creatures
+	newCreatures := make([]*Creature, 0)
+	for _, c := range env.Creatures.Objects {
+		me := c.DNA.MaxEnergy()
+		if c.Energy >= me*0.8 && rand.Float64() < deltaTime/5 {
+			c1 := c.Child()
+			c1.Pos = c.Pos
+			c1.Energy = me * 0.79
+			c.Energy = me * 0.79
+			newCreatures = append(newCreatures, c1)
+		}
+	}
+	for _, c1 := range newCreatures {
+		env.Creatures.Add(c1)
+	}
+	// Grow new food on plants
+	plantGrowth := env.SeasonalPlantGrowth()
+	for _, p := range env.Plants.Objects {
+		if rand.Float64() < deltaTime*plantGrowth/GlobalSP.PlantParams.FoodGrowthDelay {
+			// Check if there is already a food under us
+			if len(env.Food.Query(p.Pos, 0.1)) == 0 {
+				energy := math.Pow(p.Fertility, 3) * GlobalSP.PlantParams.GrownFoodEnergy
+				f := NewFood(energy, true)
+				f.Pos = p.Pos
+				f.Rot = rand.Float64() * 2 * math.Pi
+				env.Food.Add(f)
 			}
 		}
 	}
+	// Decay Food
+	foodDecay := GlobalSP.EnvironmentalParams.FoodDecayRate * env.SeasonalFoodDecay()
+	for _, f := range env.Food.Objects {
+		f.Energy -= foodDecay * deltaTime
+		if f.Energy <= 0 {
+			env.Food.Remove(f)
+		}
+	}
+
+	// Drift food with the currents
+	env.driftFood(deltaTime)
+
+	// Update hash maps
+	env.Creatures.Refresh()
+	env.Food.Refresh()
+	// We dont need to update the plants map as they never move
+	// Update creatures
+	for _, c := range env.Creatures.Objects {
+		c.updateTimer += deltaTime
+		if c.updateTimer >= GlobalSP.EnvironmentalParams.BrainUpdateDelay {
+			c.updateTimer -= GlobalSP.EnvironmentalParams.BrainUpdateDelay
+			c.Update(deltaTime, env, true)
+		} else {
+			c.Update(deltaTime, env, false)
+		}
+	}
+	env.SimTime += time.Duration(deltaTime * float64(time.Second))
+}
+
+// The light level at a position, where 1 lets creatures see their full vision range.
+// The water gets darker deeper in the map, and at night
+func (env *Environment) LightAt(pos pixel.Vec) float64 {
+	return env.lightAtDepth(env.Depth(pos)) * env.Daylight()
+}
 
-	pic := pixel.PictureDataFromImage(img)
-	return pixel.NewSprite(pic, pic.Bounds())
+// The light level at a depth, where 0 is the middle of the map and 1 is the edge
+func (env *Environment) lightAtDepth(depth float64) float64 {
+	ep := GlobalSP.EnvironmentalParams
+	t := math.Pow(math.Min(math.Max(depth, 0), 1), math.Max(ep.LightFalloff, 0.01))
+	return math.Min(math.Max(ep.SurfaceLight+(ep.DeepLight-ep.SurfaceLight)*t, 0), 1)
+}
+
+// The colour of the texel of the terrain at (i, j)
+func (env *Environment) texelColor(i, j int) color.RGBA {
+	if env.TexelsWall.At(i, j) {
+		return colornames.Black
+	}
+	d := math.Min(env.Depth(pixel.V(float64(i-env.Radius), float64(j-env.Radius))), 1)
+	// Darken the water where there is less light
+	water := lerpColor(colornames.Skyblue, color.RGBA{28, 40, 90, 255}, d)
+	return lerpColor(colornames.Black, water, 0.3+0.7*env.lightAtDepth(d))
 }
 
 func (e *Environment) ScatterFood(density float64) {
-	numFood := int(density * float64(e.Radius*e.Radius) * math.Pi)
+	numFood := int(density * e.Area())
 	for i := 0; i < numFood; i++ {
-		position := pixel.V(0, math.Sqrt(rand.Float64())*float64(e.Radius)).Rotated(rand.Float64() * 2 * math.Pi)
+		position := e.randomPos(float64(e.Radius))
 		if !e.sampleWallAt(position, true) {
 			energy := rand.Float64()*2 + 1
 			if rand.Float64() < 0.1 {
@@ -133,18 +220,26 @@ func (e *Environment) sampleWallAt(pos pixel.Vec, smooth bool) bool {
 	// The position we get has a center of 0,0 (center of the screen)
 	// The position from the texels wall has a center of radius,radius (center of the texels wall)
 	px, py := e.worldPosToMapPos(pos)
-	if !(px >= 0 && px < len(e.TexelsWall) && py >= 0 && py < len(e.TexelsWall[0])) {
-		return true
-	}
 	if smooth {
-		return e.TexelsWall[px][py] || e.TexelsWall[px+1][py] || e.TexelsWall[px][py+1] || e.TexelsWall[px-1][py] || e.TexelsWall[px][py-1] ||
-			e.TexelsWall[px+1][py+1] || e.TexelsWall[px-1][py-1] || e.TexelsWall[px+1][py-1] || e.TexelsWall[px-1][py+1]
+		return e.wallAt(px, py) || e.wallAt(px+1, py) || e.wallAt(px, py+1) || e.wallAt(px-1, py) || e.wallAt(px, py-1) ||
+			e.wallAt(px+1, py+1) || e.wallAt(px-1, py-1) || e.wallAt(px+1, py-1) || e.wallAt(px-1, py+1)
 	} else {
-		return e.TexelsWall[px][py]
+		return e.wallAt(px, py)
 	}
 
 }
 
+// Whether the texel at (i, j) is a wall. Texels off the map are walls, unless the map is a torus, where they wrap around to the other side
+func (e *Environment) wallAt(i, j int) bool {
+	size := e.TexelsWall.Size()
+	if e.Wraps() {
+		i, j = ((i%size)+size)%size, ((j%size)+size)%size
+	} else if i < 0 || j < 0 || i >= size || j >= size {
+		return true
+	}
+	return e.TexelsWall.At(i, j)
+}
+
 // Converts a world pos to an integer position on the texels wall
 func (e *Environment) worldPosToMapPos(p pixel.Vec) (int, int) {
 	return int(p.X-0.5) + e.Radius, int(p.Y-0.5) + e.Radius
@@ -163,3 +258,17 @@ func lerpColor(a, b color.RGBA, t float64) color.RGBA {
 	ca := uint8(float64(aa)*(1-t) + float64(ab)*t)
 	return color.RGBA{cr, cg, cb, ca}
 }
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
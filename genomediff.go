@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/JoshPattman/goevo"
+)
+
+// The weights of each part of the compatibility distance, as in NEAT
+type CompatibilityCoefficients struct {
+	Excess   float64 `json:"excess"`
+	Disjoint float64 `json:"disjoint"`
+	Weight   float64 `json:"weight"`
+}
+
+var DefaultCompatibilityCoefficients = CompatibilityCoefficients{
+	Excess:   1,
+	Disjoint: 1,
+	Weight:   0.4,
+}
+
+// The difference in one trait between two creatures
+type TraitDelta struct {
+	Name  string  `json:"name"`
+	A     float64 `json:"a"`
+	B     float64 `json:"b"`
+	Delta float64 `json:"delta"` // B - A
+}
+
+// A synapse that is in one or both of the genomes, matched by innovation id
+type SynapseDiff struct {
+	ID      int     `json:"id"`
+	From    int     `json:"from"`
+	To      int     `json:"to"`
+	WeightA float64 `json:"weight_a"` // 0 if the synapse is not in A
+	WeightB float64 `json:"weight_b"` // 0 if the synapse is not in B
+}
+
+// A neuron that is in one genome but not the other, or that has a different activation in each
+type NeuronDiff struct {
+	ID          int              `json:"id"`
+	Type        goevo.NeuronType `json:"type"`
+	ActivationA goevo.Activation `json:"activation_a,omitempty"`
+	ActivationB goevo.Activation `json:"activation_b,omitempty"`
+}
+
+// The differences between the genomes of two creatures, A and B.
+// Synapses and neurons are matched by their innovation ids, so the comparison is most meaningful between relatives
+type GenomeDiff struct {
+	Traits               []TraitDelta  `json:"traits"`
+	Matching             []SynapseDiff `json:"matching"`   // Synapses in both genomes
+	DisjointA            []SynapseDiff `json:"disjoint_a"` // Synapses only in A, with ids inside the range of B's ids
+	DisjointB            []SynapseDiff `json:"disjoint_b"`
+	ExcessA              []SynapseDiff `json:"excess_a"` // Synapses only in A, with ids beyond the range of B's ids
+	ExcessB              []SynapseDiff `json:"excess_b"`
+	NeuronsAdded         []NeuronDiff  `json:"neurons_added"`   // Neurons in B but not A
+	NeuronsRemoved       []NeuronDiff  `json:"neurons_removed"` // Neurons in A but not B
+	ActivationChanges    []NeuronDiff  `json:"activation_changes"`
+	MeanWeightDifference float64       `json:"mean_weight_difference"` // Of the matching synapses
+	Distance             float64       `json:"compatibility_distance"`
+}
+
+// Compare the DNA of two creatures
+func DiffGenomes(a, b CreatureDNA, coeffs CompatibilityCoefficients) GenomeDiff {
+	d := GenomeDiff{}
+	traitsA, traitsB := dnaTraits(a), dnaTraits(b)
+	for i := range traitsA {
+		d.Traits = append(d.Traits, TraitDelta{
+			Name:  traitsA[i].Name,
+			A:     traitsA[i].A,
+			B:     traitsB[i].A,
+			Delta: traitsB[i].A - traitsA[i].A,
+		})
+	}
+
+	// Synapses
+	ga, gb := a.Genotype, b.Genotype
+	maxA, maxB := maxKey(ga.Synapses), maxKey(gb.Synapses)
+	for _, sid := range sortedKeys(ga.Synapses) {
+		sa := ga.Synapses[sid]
+		if sb, ok := gb.Synapses[sid]; ok {
+			d.Matching = append(d.Matching, SynapseDiff{sid, sa.From, sa.To, sa.Weight, sb.Weight})
+			d.MeanWeightDifference += math.Abs(sa.Weight - sb.Weight)
+		} else if sid > maxB {
+			d.ExcessA = append(d.ExcessA, SynapseDiff{sid, sa.From, sa.To, sa.Weight, 0})
+		} else {
+			d.DisjointA = append(d.DisjointA, SynapseDiff{sid, sa.From, sa.To, sa.Weight, 0})
+		}
+	}
+	for _, sid := range sortedKeys(gb.Synapses) {
+		sb := gb.Synapses[sid]
+		if _, ok := ga.Synapses[sid]; ok {
+			continue
+		} else if sid > maxA {
+			d.ExcessB = append(d.ExcessB, SynapseDiff{sid, sb.From, sb.To, 0, sb.Weight})
+		} else {
+			d.DisjointB = append(d.DisjointB, SynapseDiff{sid, sb.From, sb.To, 0, sb.Weight})
+		}
+	}
+	if len(d.Matching) > 0 {
+		d.MeanWeightDifference /= float64(len(d.Matching))
+	}
+
+	// Neurons
+	for _, nid := range sortedKeys(gb.Neurons) {
+		nb := gb.Neurons[nid]
+		if na, ok := ga.Neurons[nid]; !ok {
+			d.NeuronsAdded = append(d.NeuronsAdded, NeuronDiff{ID: nid, Type: nb.Type, ActivationB: nb.Activation})
+		} else if na.Activation != nb.Activation {
+			d.ActivationChanges = append(d.ActivationChanges, NeuronDiff{ID: nid, Type: nb.Type, ActivationA: na.Activation, ActivationB: nb.Activation})
+		}
+	}
+	for _, nid := range sortedKeys(ga.Neurons) {
+		if _, ok := gb.Neurons[nid]; !ok {
+			na := ga.Neurons[nid]
+			d.NeuronsRemoved = append(d.NeuronsRemoved, NeuronDiff{ID: nid, Type: na.Type, ActivationA: na.Activation})
+		}
+	}
+
+	// As in NEAT, small genomes are not normalised by their size
+	n := math.Max(float64(len(ga.Synapses)), float64(len(gb.Synapses)))
+	if n < 20 {
+		n = 1
+	}
+	numExcess := float64(len(d.ExcessA) + len(d.ExcessB))
+	numDisjoint := float64(len(d.DisjointA) + len(d.DisjointB))
+	d.Distance = coeffs.Excess*numExcess/n + coeffs.Disjoint*numDisjoint/n + coeffs.Weight*d.MeanWeightDifference
+	return d
+}
+
+// The traits of a creature that are compared by a diff, stored in the A field
+func dnaTraits(c CreatureDNA) []TraitDelta {
+	mr := DefaultMutationGenes()
+	if c.MutationRates != nil {
+		mr = *c.MutationRates
+	}
+	return []TraitDelta{
+		{Name: "size", A: c.Size},
+		{Name: "speed", A: c.Speed},
+		{Name: "vision", A: c.Vision},
+		{Name: "diet", A: c.Diet},
+		{Name: "preferred temperature", A: c.PreferredTemperature},
+		{Name: "color hue", A: c.Color.H},
+		{Name: "bioluminescence", A: c.Bioluminescence},
+		{Name: "trait mutation rate", A: mr.TraitMutationRate},
+		{Name: "trait mutation size", A: mr.TraitMutationSize},
+		{Name: "synapse mutation probability", A: mr.SynapseMutationProbability},
+		{Name: "synapse mutation size", A: mr.SynapseMutationSize},
+		{Name: "generation", A: float64(c.Generation)},
+	}
+}
+
+func maxKey[T any](m map[int]T) int {
+	max := -1
+	for k := range m {
+		if k > max {
+			max = k
+		}
+	}
+	return max
+}
+
+// Write a short summary of the diff, with one line for each kind of difference
+func (d GenomeDiff) WriteSummary(w io.Writer) {
+	fmt.Fprintf(w, "Compatibility distance: %.3f\n", d.Distance)
+	for _, t := range d.Traits {
+		if t.Delta != 0 {
+			fmt.Fprintf(w, "%-29s %.2f -> %.2f (%+.2f)\n", t.Name, t.A, t.B, t.Delta)
+		}
+	}
+	fmt.Fprintf(w, "Synapses: %d matching (mean weight diff %.3f)\n", len(d.Matching), d.MeanWeightDifference)
+	fmt.Fprintf(w, "          %d/%d disjoint, %d/%d excess (A/B)\n", len(d.DisjointA), len(d.DisjointB), len(d.ExcessA), len(d.ExcessB))
+	fmt.Fprintf(w, "Neurons:  %d added, %d removed, %d activations changed\n", len(d.NeuronsAdded), len(d.NeuronsRemoved), len(d.ActivationChanges))
+}
+
+// Write the whole diff as human readable tables
+func (d GenomeDiff) WriteReport(w io.Writer) {
+	d.WriteSummary(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	writeSynapses := func(title string, synapses []SynapseDiff) {
+		if len(synapses) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s\nid\tfrom\tto\tweight A\tweight B\tdiff\t\n", title)
+		for _, s := range synapses {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%.3f\t%.3f\t%+.3f\t\n", s.ID, s.From, s.To, s.WeightA, s.WeightB, s.WeightB-s.WeightA)
+		}
+	}
+	writeSynapses("Matching synapses:", d.Matching)
+	writeSynapses("Disjoint synapses only in A:", d.DisjointA)
+	writeSynapses("Disjoint synapses only in B:", d.DisjointB)
+	writeSynapses("Excess synapses only in A:", d.ExcessA)
+	writeSynapses("Excess synapses only in B:", d.ExcessB)
+	writeNeurons := func(title string, neurons []NeuronDiff) {
+		if len(neurons) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s\nid\ttype\tactivation A\tactivation B\t\n", title)
+		for _, n := range neurons {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t\n", n.ID, n.Type, orDash(string(n.ActivationA)), orDash(string(n.ActivationB)))
+		}
+	}
+	writeNeurons("Neurons added in B:", d.NeuronsAdded)
+	writeNeurons("Neurons removed in B:", d.NeuronsRemoved)
+	writeNeurons("Activation changes:", d.ActivationChanges)
+	tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Load DNA from a command line argument, which may be a DNA file or a creature code
+func loadDNAArg(arg string) (CreatureDNA, error) {
+	if strings.HasPrefix(strings.TrimSpace(arg), creatureCodePrefix) {
+		return DecodeCreatureCode(arg)
+	}
+	return LoadDNAFile(arg)
+}
+
+func diffCommand(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the diff as JSON instead of tables")
+	coeffs := DefaultCompatibilityCoefficients
+	fs.Float64Var(&coeffs.Excess, "c1", coeffs.Excess, "weight of excess synapses in the compatibility distance")
+	fs.Float64Var(&coeffs.Disjoint, "c2", coeffs.Disjoint, "weight of disjoint synapses in the compatibility distance")
+	fs.Float64Var(&coeffs.Weight, "c3", coeffs.Weight, "weight of the mean weight difference in the compatibility distance")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("expected two DNA files or creature codes")
+	}
+	a, err := loadDNAArg(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := loadDNAArg(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	d := DiffGenomes(a, b, coeffs)
+	if *asJSON {
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	d.WriteReport(os.Stdout)
+	return nil
+}
@@ -15,6 +15,7 @@ type HashMap[T HashMappable] struct {
 	Objects   []T
 	areas     map[pixel.Vec][]T
 	areaScale float64
+	wrapSize  float64 // The width of the square the objects wrap around in, or 0 if they do not wrap
 }
 
 func NewHashMap[T HashMappable](areaScale float64) *HashMap[T] {
@@ -50,6 +51,17 @@ func (m *HashMap[T]) Remove(o T) {
 
 }
 
+// Check if the object itself is in the hashmap.
+// This compares the objects rather than using Eq, as a newborn creature starts at the same position as its parent
+func (m *HashMap[T]) Contains(o T) bool {
+	for _, o2 := range m.Objects {
+		if HashMappable(o) == HashMappable(o2) {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *HashMap[T]) Refresh() {
 	// Clear the areas
 	for k := range m.areas {
@@ -71,7 +83,34 @@ func (m *HashMap[T]) toAreaPos(pos pixel.Vec) pixel.Vec {
 	return pixel.V(float64(ax), float64(ay))
 }
 
+// Make queries find objects across the edges of a square `size` wide centred on the origin, as if each edge joins the opposite one.
+// The objects must all be inside the square
+func (m *HashMap[T]) SetWrap(size float64) {
+	m.wrapSize = size
+}
+
 func (m *HashMap[T]) Query(pos pixel.Vec, radius float64) []T {
+	if m.wrapSize <= 0 {
+		return m.query(pos, radius)
+	}
+	// Search each copy of the square around the one `pos` is in that the search circle reaches into.
+	// Limiting the radius to half the square stops an object being found in two copies
+	half := m.wrapSize / 2
+	radius = math.Min(radius, half)
+	objects := make([]T, 0)
+	for _, xo := range []float64{-m.wrapSize, 0, m.wrapSize} {
+		for _, yo := range []float64{-m.wrapSize, 0, m.wrapSize} {
+			p := pos.Add(pixel.V(xo, yo))
+			if p.X+radius < -half || p.X-radius > half || p.Y+radius < -half || p.Y-radius > half {
+				continue
+			}
+			objects = append(objects, m.query(p, radius)...)
+		}
+	}
+	return objects
+}
+
+func (m *HashMap[T]) query(pos pixel.Vec, radius float64) []T {
 	searchAreasRadius := int(math.Ceil(radius / m.areaScale))
 	ap := m.toAreaPos(pos)
 	objects := make([]T, 0)
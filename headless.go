@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Run the simulation without a window as fast as possible, writing samples of the population to a CSV file.
+// Along with a timeline in the params file, this is for running controlled experiments
+func headlessCommand(args []string) error {
+	fs := flag.NewFlagSet("headless", flag.ContinueOnError)
+	duration := fs.Float64("duration", 3600, "length of the run in sim seconds")
+	seed := fs.Int64("seed", 0, "seed of the run (0 picks a random seed)")
+	sample := fs.Float64("sample", 60, "sim seconds between samples")
+	paramsPath := fs.String("params", "", "params file to use instead of data/simulation_params.json")
+	export := fs.Bool("export", false, "export the population to data/populations/ at the end of the run")
+	outPath := fs.String("o", "", "path to write the samples to (default data/runs/run_<time>.csv)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+	if *duration <= 0 || *sample <= 0 {
+		return errors.New("duration and sample must be positive")
+	}
+	if *paramsPath != "" {
+		// Start from the built-in parameters rather than the params file, so that the run only depends on the file it was given
+		GlobalSP = DefaultSimParams()
+		if err := loadSimParams(*paramsPath); err != nil {
+			return err
+		}
+	}
+	if *seed != 0 {
+		rand.Seed(*seed)
+	}
+	if *outPath == "" {
+		*outPath = filepath.Join("data", "runs", fmt.Sprintf("run_%d.csv", time.Now().Unix()))
+	}
+	if err := os.MkdirAll(filepath.Dir(*outPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(*outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+
+	env := NewEnvironment(GlobalSP.MapParams.MapRadius)
+	if err := SeedPopulation(env, GlobalSP.MapParams.InitialPopulation); err != nil {
+		return err
+	}
+
+	// The params with a timeline are logged too, so their changes can be lined up with the population
+	header := []string{"sim_time", "creatures", "food", "mean_diet", "mean_size", "mean_speed", "mean_vision", "max_generation"}
+	for _, track := range GlobalSP.Timeline {
+		header = append(header, track.Param)
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	lastSample := -1.0
+	writeSample := func() error {
+		lastSample = env.SimTime.Seconds()
+		n := float64(len(env.Creatures.Objects))
+		diet, size, speed, vision, generation := 0.0, 0.0, 0.0, 0.0, 0
+		for _, c := range env.Creatures.Objects {
+			diet += c.DNA.Diet / n
+			size += c.DNA.Size / n
+			speed += c.DNA.Speed / n
+			vision += c.DNA.Vision / n
+			if c.DNA.Generation > generation {
+				generation = c.DNA.Generation
+			}
+		}
+		row := []string{
+			strconv.FormatFloat(env.SimTime.Seconds(), 'f', 1, 64),
+			strconv.Itoa(len(env.Creatures.Objects)),
+			strconv.Itoa(len(env.Food.Objects)),
+			strconv.FormatFloat(diet, 'f', 4, 64),
+			strconv.FormatFloat(size, 'f', 4, 64),
+			strconv.FormatFloat(speed, 'f', 4, 64),
+			strconv.FormatFloat(vision, 'f', 4, 64),
+			strconv.Itoa(generation),
+		}
+		for _, track := range GlobalSP.Timeline {
+			v, _ := GlobalSP.ParamValue(track.Param)
+			row = append(row, strconv.FormatFloat(v, 'g', 6, 64))
+		}
+		fmt.Printf("Sim Time: %.0fs, Creatures: %d, Food: %d\n", env.SimTime.Seconds(), len(env.Creatures.Objects), len(env.Food.Objects))
+		return w.Write(row)
+	}
+
+	nextSample := 0.0
+	for env.SimTime.Seconds() < *duration {
+		if env.SimTime.Seconds() >= nextSample {
+			if err := writeSample(); err != nil {
+				return err
+			}
+			nextSample += *sample
+		}
+		if len(env.Creatures.Objects) == 0 {
+			fmt.Println("Every creature has died")
+			break
+		}
+		env.Update(1 / 60.0)
+	}
+	if env.SimTime.Seconds() != lastSample {
+		if err := writeSample(); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	fmt.Println("Wrote samples to", *outPath)
+	if *export {
+		return exportPopulation(env, env.Creatures.Objects, "run")
+	}
+	return nil
+}
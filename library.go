@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Returned when saving to a library entry that already exists without asking to overwrite it
+var ErrLibraryEntryExists = errors.New("a creature with that name is already in the library")
+
+// A creature saved in the library, along with some information about when and why it was saved
+type LibraryEntry struct {
+	Name       string        `json:"name"`
+	Notes      string        `json:"notes"`
+	SavedAt    time.Time     `json:"saved_at"`
+	SimTime    float64       `json:"sim_time"` // The sim time in seconds when the creature was saved
+	Generation int           `json:"generation"`
+	Stats      CreatureStats `json:"stats"`
+	DNA        CreatureDNA   `json:"dna"`
+}
+
+// A snapshot of a creature's stats when it was saved
+type CreatureStats struct {
+	Energy        float64 `json:"energy"`
+	MaxEnergy     float64 `json:"max_energy"`
+	Size          float64 `json:"size"`
+	Speed         float64 `json:"speed"`
+	Vision        float64 `json:"vision"`
+	Diet          float64 `json:"diet"`
+	Metabolism    float64 `json:"metabolism"`
+	HiddenNeurons int     `json:"hidden_neurons"`
+	Synapses      int     `json:"synapses"`
+}
+
+// Create a library entry for `c`, saved at sim time `simTime`
+func NewLibraryEntry(name, notes string, c *Creature, simTime time.Duration) LibraryEntry {
+	_, numHidden, _ := c.DNA.Genotype.Topology()
+	return LibraryEntry{
+		Name:       name,
+		Notes:      notes,
+		SavedAt:    time.Now(),
+		SimTime:    simTime.Seconds(),
+		Generation: c.DNA.Generation,
+		Stats: CreatureStats{
+			Energy:        c.Energy,
+			MaxEnergy:     c.DNA.MaxEnergy(),
+			Size:          c.DNA.Size,
+			Speed:         c.DNA.Speed,
+			Vision:        c.DNA.Vision,
+			Diet:          c.DNA.Diet,
+			Metabolism:    c.DNA.Metabolism(),
+			HiddenNeurons: numHidden,
+			Synapses:      len(c.DNA.Genotype.Synapses),
+		},
+		DNA: c.DNA.Copied(),
+	}
+}
+
+// Make a name safe to use as a file name. Returns an empty string if nothing is left
+func CleanLibraryName(name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '_'
+		}
+		return -1
+	}, strings.TrimSpace(name))
+	return cleaned
+}
+
+// Check whether an entry called `name` is in the library
+func LibraryEntryExists(name string) bool {
+	_, err := os.Stat(getLibraryPath(name))
+	return err == nil
+}
+
+// Write an entry to the library. If an entry of the same name exists, ErrLibraryEntryExists is returned unless `overwrite` is true
+func SaveLibraryEntry(e LibraryEntry, overwrite bool) error {
+	if e.Name == "" || CleanLibraryName(e.Name) != e.Name {
+		return fmt.Errorf("invalid library name '%s'", e.Name)
+	}
+	if !overwrite && LibraryEntryExists(e.Name) {
+		return ErrLibraryEntryExists
+	}
+	if err := os.MkdirAll(getLibraryDir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(getLibraryPath(e.Name), data, 0644)
+}
+
+// Read the library entry called `name`
+func LoadLibraryEntry(name string) (LibraryEntry, error) {
+	data, err := os.ReadFile(getLibraryPath(name))
+	if err != nil {
+		return LibraryEntry{}, err
+	}
+	return decodeLibraryEntry(data)
+}
+
+func decodeLibraryEntry(data []byte) (LibraryEntry, error) {
+	var e LibraryEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return LibraryEntry{}, err
+	}
+	return e, nil
+}
+
+// Read every entry in the library, most recently saved first. Entries that cannot be read are skipped and reported
+func ListLibrary() ([]LibraryEntry, error) {
+	files, err := os.ReadDir(getLibraryDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	entries := make([]LibraryEntry, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		e, err := LoadLibraryEntry(strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			fmt.Println("Skipping library entry", f.Name(), ":", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].SavedAt.After(entries[j].SavedAt)
+	})
+	return entries, nil
+}
+
+func getLibraryDir() string {
+	return "data/library"
+}
+
+func getLibraryPath(name string) string {
+	return filepath.Join(getLibraryDir(), name+".json")
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/faiface/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+type libraryMode int
+
+const (
+	libraryClosed libraryMode = iota
+	libraryNaming
+	libraryNotes
+	libraryConfirmOverwrite
+	libraryConfirmSlotOverwrite
+	libraryBrowsing
+)
+
+// The number of entries shown at once in the library browser
+const libraryPageSize = 15
+
+// The in-game prompts for saving a creature to the library or a slot, and the browser for picking one out of the library.
+// While it is open, it takes all keyboard input
+type LibraryUI struct {
+	mode        libraryMode
+	input       string
+	pending     LibraryEntry // The entry being saved
+	pendingSlot int          // The slot being saved to
+	pendingDNA  CreatureDNA  // The DNA being saved to a slot
+	entries     []LibraryEntry
+	selected    int
+	text        *text.Text
+}
+
+func NewLibraryUI(atlas *text.Atlas) *LibraryUI {
+	return &LibraryUI{
+		text: text.New(pixel.ZV, atlas),
+	}
+}
+
+func (l *LibraryUI) IsOpen() bool {
+	return l.mode != libraryClosed
+}
+
+// Start saving `c` to the library, by first asking for a name then some notes
+func (l *LibraryUI) StartSave(c *Creature, simTime time.Duration) {
+	l.pending = NewLibraryEntry("", "", c, simTime)
+	l.input = fmt.Sprintf("gen%d_%s", c.DNA.Generation, time.Now().Format("20060102_150405"))
+	l.mode = libraryNaming
+}
+
+// Save `dna` to a save slot, first asking before overwriting a creature already in the slot
+func (l *LibraryUI) StartSlotSave(dna CreatureDNA, slot int) {
+	l.pendingDNA = dna.Copied()
+	l.pendingSlot = slot
+	if _, err := os.Stat(getSaveSlotPath(slot)); err == nil {
+		l.mode = libraryConfirmSlotOverwrite
+	} else {
+		l.saveSlot()
+	}
+}
+
+// Open the browser with the entries currently in the library
+func (l *LibraryUI) OpenBrowser() {
+	entries, err := ListLibrary()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	l.entries = entries
+	l.selected = 0
+	l.mode = libraryBrowsing
+}
+
+// Handle the keyboard input for this frame. If a creature was picked in the browser, its DNA is returned
+func (l *LibraryUI) Update(win *pixelgl.Window) (CreatureDNA, bool) {
+	switch l.mode {
+	case libraryNaming, libraryNotes:
+		l.input = updateTextInput(win, l.input)
+		if win.JustPressed(pixelgl.KeyEscape) {
+			l.mode = libraryClosed
+		} else if win.JustPressed(pixelgl.KeyEnter) || win.JustPressed(pixelgl.KeyKPEnter) {
+			if l.mode == libraryNaming {
+				if name := CleanLibraryName(l.input); name != "" {
+					l.pending.Name = name
+					l.input = ""
+					l.mode = libraryNotes
+				}
+			} else {
+				l.pending.Notes = strings.TrimSpace(l.input)
+				if LibraryEntryExists(l.pending.Name) {
+					l.mode = libraryConfirmOverwrite
+				} else {
+					l.save(false)
+				}
+			}
+		}
+	case libraryConfirmOverwrite:
+		if win.JustPressed(pixelgl.KeyY) {
+			l.save(true)
+		} else if win.JustPressed(pixelgl.KeyN) || win.JustPressed(pixelgl.KeyEscape) {
+			// Go back to choosing a name
+			l.input = l.pending.Name
+			l.mode = libraryNaming
+		}
+	case libraryConfirmSlotOverwrite:
+		if win.JustPressed(pixelgl.KeyY) {
+			l.saveSlot()
+		} else if win.JustPressed(pixelgl.KeyN) || win.JustPressed(pixelgl.KeyEscape) {
+			l.mode = libraryClosed
+		}
+	case libraryBrowsing:
+		if justPressedOrRepeated(win, pixelgl.KeyUp) && l.selected > 0 {
+			l.selected--
+		}
+		if justPressedOrRepeated(win, pixelgl.KeyDown) && l.selected < len(l.entries)-1 {
+			l.selected++
+		}
+		if win.JustPressed(pixelgl.KeyEscape) {
+			l.mode = libraryClosed
+		} else if (win.JustPressed(pixelgl.KeyEnter) || win.JustPressed(pixelgl.KeyKPEnter)) && l.selected < len(l.entries) {
+			l.mode = libraryClosed
+			return l.entries[l.selected].DNA.Copied(), true
+		}
+	}
+	return CreatureDNA{}, false
+}
+
+func (l *LibraryUI) save(overwrite bool) {
+	if err := SaveLibraryEntry(l.pending, overwrite); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Saved creature to", getLibraryPath(l.pending.Name))
+	}
+	l.mode = libraryClosed
+}
+
+func (l *LibraryUI) saveSlot() {
+	ensureDataDir()
+	if err := SaveDNAFile(getSaveSlotPath(l.pendingSlot), l.pendingDNA); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Saved creature to", getSaveSlotPath(l.pendingSlot))
+	}
+	l.mode = libraryClosed
+}
+
+// The hotkeys for the current prompt
+func (l *LibraryUI) Instructions() string {
+	switch l.mode {
+	case libraryNaming:
+		return "Type A Name For The Creature, (Enter) To Continue, (Esc) To Cancel"
+	case libraryNotes:
+		return "Type Some Notes About The Creature, (Enter) To Save, (Esc) To Cancel"
+	case libraryConfirmOverwrite:
+		return "(Y)es To Overwrite, (N)o To Choose Another Name"
+	case libraryConfirmSlotOverwrite:
+		return "(Y)es To Overwrite, (N)o To Cancel"
+	case libraryBrowsing:
+		return "(Up/Down) To Choose, (Enter) To Spawn The Creature, (Esc) To Close"
+	}
+	return ""
+}
+
+// Draw the prompt or browser in the middle of the window
+func (l *LibraryUI) Draw(win *pixelgl.Window, imd *imdraw.IMDraw) {
+	if !l.IsOpen() {
+		return
+	}
+	l.text.Clear()
+	l.text.Color = colornames.White
+	switch l.mode {
+	case libraryNaming:
+		fmt.Fprintf(l.text, "Save To Library\n\nName: %s_", l.input)
+	case libraryNotes:
+		fmt.Fprintf(l.text, "Save To Library\n\nName: %s\nNotes: %s_", l.pending.Name, l.input)
+	case libraryConfirmOverwrite:
+		fmt.Fprintf(l.text, "Save To Library\n\n'%s' is already in the library.\nOverwrite it? (y/n)", l.pending.Name)
+	case libraryConfirmSlotOverwrite:
+		fmt.Fprintf(l.text, "Save To Slot\n\nSlot %d already has a creature in it.\nOverwrite it? (y/n)", l.pendingSlot)
+	case libraryBrowsing:
+		l.drawBrowser()
+	}
+
+	bounds := l.text.Bounds()
+	loc := win.Bounds().Center().Sub(bounds.Center())
+	imd.Clear()
+	imd.Color = color.RGBA{0, 0, 0, 200}
+	panel := bounds.Moved(loc)
+	panel = pixel.R(panel.Min.X-10, panel.Min.Y-10, panel.Max.X+10, panel.Max.Y+10)
+	corners := panel.Vertices()
+	imd.Push(corners[:]...)
+	imd.Polygon(0)
+	imd.Draw(win)
+	l.text.Draw(win, pixel.IM.Moved(loc))
+}
+
+func (l *LibraryUI) drawBrowser() {
+	fmt.Fprintf(l.text, "Creature Library (%d)\n\n", len(l.entries))
+	if len(l.entries) == 0 {
+		fmt.Fprintf(l.text, "The library is empty. Select a creature and press (y) to save it here.")
+		return
+	}
+	// Scroll so that the selected entry is always visible
+	first := l.selected - libraryPageSize/2
+	if first > len(l.entries)-libraryPageSize {
+		first = len(l.entries) - libraryPageSize
+	}
+	if first < 0 {
+		first = 0
+	}
+	for i := first; i < len(l.entries) && i < first+libraryPageSize; i++ {
+		e := l.entries[i]
+		l.text.Color = colornames.Gray
+		if i == l.selected {
+			l.text.Color = colornames.Yellow
+		}
+		fmt.Fprintf(l.text, "%-30s gen %-5d %s\n", e.Name, e.Generation, e.SavedAt.Format("2006-01-02 15:04"))
+	}
+	e := l.entries[l.selected]
+	l.text.Color = colornames.White
+	fmt.Fprintf(l.text, "\nSaved at sim time %.1fs\n", e.SimTime)
+	fmt.Fprintf(l.text, "Energy %.2f/%.2f, Metabolism %.2f\n", e.Stats.Energy, e.Stats.MaxEnergy, e.Stats.Metabolism)
+	fmt.Fprintf(l.text, "Size %.2f, Speed %.2f, Vision %.2f, Diet %.2f\n", e.Stats.Size, e.Stats.Speed, e.Stats.Vision, e.Stats.Diet)
+	fmt.Fprintf(l.text, "Brain: %d hidden neurons, %d synapses\n", e.Stats.HiddenNeurons, e.Stats.Synapses)
+	if e.Notes != "" {
+		fmt.Fprintf(l.text, "Notes: %s\n", e.Notes)
+	}
+}
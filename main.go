@@ -2,16 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image/color"
 	"image/png"
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
-	"github.com/JoshPattman/goevo"
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/imdraw"
 	"github.com/faiface/pixel/pixelgl"
@@ -29,44 +30,46 @@ var (
 )
 
 func main() {
+	rand.Seed(time.Now().UnixNano())
 	ensureDataDir()
 	err := reloadSimParams()
 	if err != nil {
 		fmt.Println(err)
+	}
+	// Only write the default params if there are none, so that a mistake in the file does not wipe it
+	if errors.Is(err, os.ErrNotExist) {
 		data, _ := json.MarshalIndent(GlobalSP, "", "  ")
 		if err := os.WriteFile(getParamsPath(), data, 0644); err != nil {
 			panic(err)
 		}
 	}
-	pixelgl.Run(run)
-}
-
-func run() {
-	simTimer := time.Second * 0
-
 	// Setup goevo
 	gtCounter = &SaveLoadCounter{}
-	gtOrig := goevo.NewGenotype(gtCounter, NewCreature(CreatureDNA{}).NumInputs(), 3, goevo.ActivationLinear, goevo.ActivationTanh)
+	// Run a command line tool instead of the game if one was asked for
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	pixelgl.Run(func() { run(newDefaultEnvironment()) })
+}
 
-	// Setup Environment
+// Create the map from the parameters, with the initial population in it
+func newDefaultEnvironment() *Environment {
 	env := NewEnvironment(GlobalSP.MapParams.MapRadius)
 	//env.ScatterFood(0.01)
-	for i := 0; i < GlobalSP.MapParams.InitialCreaturesNumber; i++ {
-		gt := goevo.NewGenotypeCopy(gtOrig)
-		goevo.AddRandomSynapse(gtCounter, gt, 1, false, 5)
-		goevo.AddRandomSynapse(gtCounter, gt, 1, false, 5)
-		goevo.AddRandomSynapse(gtCounter, gt, 1, false, 5)
-		c := NewCreature(CreatureDNA{
-			Size:     1 + (rand.Float64()-0.5)*2,
-			Speed:    1 + (rand.Float64()-0.5)*2,
-			Diet:     rand.Float64(),
-			Genotype: gt,
-			Color:    RandomHSV(),
-			Vision:   1,
-		})
-		c.Pos = pixel.V(math.Sqrt(rand.Float64())*float64(GlobalSP.MapParams.MapRadius)*0.25, 0).Rotated(rand.Float64() * 2 * math.Pi)
-		env.Creatures.Add(c)
+	if err := SeedPopulation(env, GlobalSP.MapParams.InitialPopulation); err != nil {
+		fmt.Println(err)
 	}
+	return env
+}
+
+// Run the game on `env`. The environment is made before the window is opened, so that a problem with it can be reported without a crash
+func run(env *Environment) {
+	// Cloning and importing creatures bring in fresh energy as well, so they are turned off along with feeding
+	isFeedingAllowed := currentScenario == nil || !currentScenario.Goal.NoFeeding
 
 	// Setup Window
 	cfg := pixelgl.WindowConfig{
@@ -81,7 +84,7 @@ func run() {
 	}
 
 	// Load Sprites
-	terrainSprite := env.GetTerrainSprite()
+	terrain := NewTerrainRenderer(env)
 	veggieFoodSprite, meatFoodSprite, foodPic := getFoodSprites()
 	creatureSprite, creaturePic := getCreatureSprite()
 	plantSprite, plantPic := getPlantSprite()
@@ -96,17 +99,53 @@ func run() {
 	atlas := text.NewAtlas(basicfont.Face7x13, text.ASCII)
 	numCreaturesText := text.New(pixel.ZV, atlas)
 	timerText := text.New(pixel.ZV, atlas)
+	scenarioText := text.New(pixel.ZV, atlas)
+	scenarioStatus := ScenarioStatus{}
 
 	// Create creature stats elements
 	creatureStats := text.New(pixel.ZV, atlas)
 	var activeCreature *Creature
-	vis := goevo.NewGenotypeVisualiser()
-	vis.ImgSizeX = 400
-	vis.ImgSizeY = 800
-	vis.NeuronSize = 5
-	var currentCreatureBrainSprite *pixel.Sprite
+	brainView := NewBrainView(atlas)
 	instructionsText := text.New(pixel.ZV, atlas)
 	isActiveGrabbed := false
+	isEditingBrain := false
+	library := NewLibraryUI(atlas)
+	codePrompt := NewCodePrompt(atlas)
+	var diffBase *CreatureDNA // The creature that the selected creature is compared to in the diff panel
+	isShowingDiff := false
+	isShowingCurrents := false
+	isShowingTemperature := false
+	painter := NewWorldPainter()
+	diffText := text.New(pixel.ZV, atlas)
+	var possessedCreature *Creature
+	var actionRecorder *ActionRecorder
+	stopRecording := func() {
+		if actionRecorder != nil {
+			if err := actionRecorder.Close(); err != nil {
+				fmt.Println(err)
+			}
+			fmt.Println("Recorded", actionRecorder.Count, "samples")
+			actionRecorder = nil
+		}
+		if possessedCreature != nil {
+			possessedCreature.inputHook = nil
+		}
+	}
+	// Add a creature made from imported DNA, and pick it up so it can be placed
+	spawnImported := func(dna CreatureDNA) {
+		activeCreature = NewCreature(dna)
+		env.Creatures.Add(activeCreature)
+		isActiveGrabbed = true
+		brainView.SetGenotype(activeCreature.DNA.Genotype, activeCreature.InputNames(), creatureOutputNames)
+		gtCounter.SafeWith(dna.Genotype)
+	}
+	releasePossession := func() {
+		stopRecording()
+		if possessedCreature != nil {
+			possessedCreature.possessedOutput = nil
+			possessedCreature = nil
+		}
+	}
 
 	// Define player control variables
 	offset := pixel.V(500, 400)
@@ -116,93 +155,109 @@ func run() {
 	for !win.Closed() {
 		// Default instructions
 		instructionsText.Clear()
-		fmt.Fprintf(instructionsText, "(I)mport Creature, Sca(t)ter Food, (L)oad Sim Params")
+		fmt.Fprintf(instructionsText, "(I)mport Creature, Open Library (U), I(m)port Creature Code, Export Population (Z), Show Currents (F5), Show Temperature (F6), Export Map (F7), Paint (F8), Sca(t)ter Food, (L)oad Sim Params")
+		// The prompts take all keyboard input while they are open
+		keyboardCaptured := library.IsOpen() || codePrompt.IsOpen()
+		if library.IsOpen() {
+			if dna, ok := library.Update(win); ok {
+				spawnImported(dna)
+			}
+		} else if codePrompt.IsOpen() {
+			if dna, ok := codePrompt.Update(win); ok {
+				spawnImported(dna)
+			}
+		}
 		// Update user controls
 		fastForwardSteps := 1
-		if win.Pressed(pixelgl.KeyA) {
-			offset.X += 10 / scale
-		}
-		if win.Pressed(pixelgl.KeyD) {
-			offset.X -= 10 / scale
-		}
-		if win.Pressed(pixelgl.KeyW) {
-			offset.Y -= 10 / scale
-		}
-		if win.Pressed(pixelgl.KeyS) {
-			offset.Y += 10 / scale
-		}
-		if win.Pressed(pixelgl.KeyQ) {
-			scale /= 1.01
-		}
-		if win.Pressed(pixelgl.KeyE) {
-			scale *= 1.01
-		}
-		if win.Pressed(pixelgl.KeyF) {
-			fastForwardSteps = 10
-		}
-		if win.Pressed(pixelgl.KeyL) {
-			err := reloadSimParams()
-			if err != nil {
-				fmt.Println(err)
+		if !keyboardCaptured {
+			if win.Pressed(pixelgl.KeyA) {
+				offset.X += 10 / scale
 			}
-		}
-
-		if win.JustPressed(pixelgl.KeyT) {
-			env.ScatterFood(0.01)
-		}
-		for i := 0; i < fastForwardSteps; i++ {
-			// Update Sim
-			// Child creatures
-			newCreatures := make([]*Creature, 0)
-			for _, c := range env.Creatures.Objects {
-				me := c.DNA.MaxEnergy()
-				if c.Energy >= me*0.8 && rand.Float64() < (1/60.0)/5 {
-					c1 := c.Child()
-					c1.Pos = c.Pos
-					c1.Energy = me * 0.79
-					c.Energy = me * 0.79
-					newCreatures = append(newCreatures, c1)
-				}
+			if win.Pressed(pixelgl.KeyD) {
+				offset.X -= 10 / scale
 			}
-			for _, c1 := range newCreatures {
-				env.Creatures.Add(c1)
+			if win.Pressed(pixelgl.KeyW) {
+				offset.Y -= 10 / scale
 			}
-			// Grow new food on plants
-			for _, p := range env.Plants.Objects {
-				if rand.Float64() < (1/60.0)/GlobalSP.PlantParams.FoodGrowthDelay {
-					// Check if there is already a food under us
-					if len(env.Food.Query(p.Pos, 0.1)) == 0 {
-						energy := math.Pow(p.Fertility, 3) * GlobalSP.PlantParams.GrownFoodEnergy
-						f := NewFood(energy, true)
-						f.Pos = p.Pos
-						f.Rot = rand.Float64() * 2 * math.Pi
-						env.Food.Add(f)
+			if win.Pressed(pixelgl.KeyS) {
+				offset.Y += 10 / scale
+			}
+			if win.Pressed(pixelgl.KeyQ) {
+				// Zooming out stops once two widths of the map fit on the screen, so that a torus is not drawn over and over
+				scale = math.Max(scale/1.01, math.Max(win.Bounds().W(), win.Bounds().H())/float64(env.Radius*4))
+			}
+			if win.Pressed(pixelgl.KeyE) {
+				scale *= 1.01
+			}
+			if win.Pressed(pixelgl.KeyF) {
+				fastForwardSteps = 10
+			}
+			if win.Pressed(pixelgl.KeyL) {
+				err := reloadSimParams()
+				if err != nil {
+					fmt.Println(err)
+				}
+				// The scenario's parameters still take priority over the parameters file
+				if currentScenario != nil {
+					if err := currentScenario.ApplyParams(); err != nil {
+						fmt.Println(err)
 					}
 				}
 			}
-			// Decay Food
-			for _, f := range env.Food.Objects {
-				f.Energy -= GlobalSP.EnvironmentalParams.FoodDecayRate * (1 / 60.0)
-				if f.Energy <= 0 {
-					env.Food.Remove(f)
+
+			if win.JustPressed(pixelgl.KeyT) && isFeedingAllowed {
+				env.ScatterFood(0.01)
+			}
+			if win.JustPressed(pixelgl.KeyU) && isFeedingAllowed {
+				library.OpenBrowser()
+			}
+			if win.JustPressed(pixelgl.KeyM) && isFeedingAllowed {
+				codePrompt.Open()
+			}
+			if win.JustPressed(pixelgl.KeyF5) {
+				isShowingCurrents = !isShowingCurrents
+			}
+			if win.JustPressed(pixelgl.KeyF6) {
+				isShowingTemperature = !isShowingTemperature
+			}
+			if win.JustPressed(pixelgl.KeyF8) {
+				painter.Active = !painter.Active
+				// The mouse buttons are used by the brush while painting
+				activeCreature = nil
+				isActiveGrabbed = false
+				isEditingBrain = false
+			}
+			if win.JustPressed(pixelgl.KeyF7) {
+				if _, err := exportMap(env, "map"); err != nil {
+					fmt.Println(err)
 				}
 			}
-
-			// Update hash maps
-			env.Creatures.Refresh()
-			env.Food.Refresh()
-			// We dont need to update the plants map as they never move
-			// Update creatures
-			for _, c := range env.Creatures.Objects {
-				c.updateTimer += 1 / 60.0
-				if c.updateTimer >= GlobalSP.EnvironmentalParams.BrainUpdateDelay {
-					c.updateTimer -= GlobalSP.EnvironmentalParams.BrainUpdateDelay
-					c.Update(1/60.0, env, true)
+			isShift := win.Pressed(pixelgl.KeyLeftShift) || win.Pressed(pixelgl.KeyRightShift)
+			if win.JustPressed(pixelgl.KeyZ) && !(isShift && activeCreature != nil) {
+				if err := exportPopulation(env, env.Creatures.Objects, "population"); err != nil {
+					fmt.Println(err)
+				}
+			}
+		}
+		// Drive the possessed creature from the keyboard, and keep the camera on it
+		if possessedCreature != nil {
+			if possessedCreature != activeCreature || !env.Creatures.Contains(possessedCreature) {
+				releasePossession()
+			} else {
+				if keyboardCaptured {
+					possessedCreature.possessedOutput = []float64{0, -1, -1}
 				} else {
-					c.Update(1/60.0, env, false)
+					possessedCreature.possessedOutput = getKeyboardCreatureOutput(win)
 				}
+				offset = win.Bounds().Center().Sub(possessedCreature.Pos)
 			}
-			simTimer += time.Second / 60
+		}
+		for i := 0; i < fastForwardSteps; i++ {
+			env.Update(1 / 60.0)
+		}
+		// Keep the camera over the map, as every copy of a torus looks the same
+		if env.Wraps() {
+			offset = win.Bounds().Center().Sub(env.WrapPos(win.Bounds().Center().Sub(offset)))
 		}
 
 		// Render
@@ -211,75 +266,178 @@ func run() {
 		foodBatch.Clear()
 		creatureBatch.Clear()
 		plantBatch.Clear()
+		// A torus is drawn once for every copy of it on the screen, so that the map can be seen wrapping around
+		viewMin := win.Bounds().Min.Sub(win.Bounds().Center()).Scaled(1 / scale).Add(win.Bounds().Center()).Sub(offset)
+		viewMax := win.Bounds().Max.Sub(win.Bounds().Center()).Scaled(1 / scale).Add(win.Bounds().Center()).Sub(offset)
+		view := pixel.R(viewMin.X, viewMin.Y, viewMax.X, viewMax.Y)
+		worldCopies := env.VisibleCopies(viewMin, viewMax)
 		// Draw terrain
-		terrainSprite.Draw(win, pixel.IM.Moved(offset).Scaled(win.Bounds().Center(), scale))
+		terrain.Draw(win, pixel.IM.Moved(offset).Scaled(win.Bounds().Center(), scale), view, worldCopies)
+		// Only the objects that can be seen in each copy are drawn, as big maps have far more than fit on the screen
 		// Draw food
-		for _, f := range env.Food.Objects {
-			var s *pixel.Sprite
-			if f.IsVeggie {
-				s = veggieFoodSprite
-			} else {
-				s = meatFoodSprite
+		for _, wc := range worldCopies {
+			copyOffset := offset.Add(wc)
+			copyView := view.Moved(wc.Scaled(-1))
+			for _, f := range env.Food.Objects {
+				if !isInView(copyView, f.Pos, f.Radius()) {
+					continue
+				}
+				var s *pixel.Sprite
+				if f.IsVeggie {
+					s = veggieFoodSprite
+				} else {
+					s = meatFoodSprite
+				}
+				s.Draw(foodBatch, pixel.IM.Rotated(pixel.ZV, f.Rot).Scaled(pixel.ZV, f.Radius()/s.Frame().W()).Moved(f.Pos).Moved(copyOffset).Scaled(win.Bounds().Center(), scale))
 			}
-			s.Draw(foodBatch, pixel.IM.Rotated(pixel.ZV, f.Rot).Scaled(pixel.ZV, f.Radius()/s.Frame().W()).Moved(f.Pos).Moved(offset).Scaled(win.Bounds().Center(), scale))
 		}
 		foodBatch.Draw(win)
+		// Draw the glow of bioluminescent creatures
+		imd.Clear()
+		for _, wc := range worldCopies {
+			copyView := view.Moved(wc.Scaled(-1))
+			for _, c := range env.Creatures.Objects {
+				if glow := c.DNA.Glow(); glow > 0 && isInView(copyView, c.Pos, c.Radius*(0.6+glow)) {
+					imd.Color = pixel.RGB(0.5, 1, 0.9).Mul(pixel.Alpha(glow * 0.35))
+					imd.Push(c.Pos.Add(offset).Add(wc).Sub(win.Bounds().Center()).Scaled(scale).Add(win.Bounds().Center()))
+					imd.Circle(c.Radius*(0.6+glow)*scale, 0)
+				}
+			}
+		}
+		imd.Draw(win)
 		// Draw creatures
-		for _, c := range env.Creatures.Objects {
-			creatureSprite.DrawColorMask(creatureBatch, pixel.IM.Scaled(pixel.ZV, c.Radius/creatureSprite.Frame().W()).Rotated(pixel.ZV, c.Rot).Moved(c.Pos).Moved(offset).Scaled(win.Bounds().Center(), scale), c.DNA.Color.ToColor())
+		for _, wc := range worldCopies {
+			copyOffset := offset.Add(wc)
+			copyView := view.Moved(wc.Scaled(-1))
+			for _, c := range env.Creatures.Objects {
+				if !isInView(copyView, c.Pos, c.Radius) {
+					continue
+				}
+				creatureSprite.DrawColorMask(creatureBatch, pixel.IM.Scaled(pixel.ZV, c.Radius/creatureSprite.Frame().W()).Rotated(pixel.ZV, c.Rot).Moved(c.Pos).Moved(copyOffset).Scaled(win.Bounds().Center(), scale), c.DNA.Color.ToColor())
+			}
 		}
 		creatureBatch.Draw(win)
 		// Draw plants
-		for _, p := range env.Plants.Objects {
-			colorGreen := lerpColor(colornames.Lightgreen, colornames.Darkgreen, p.Shading)
-			colorBrown := lerpColor(colornames.Yellow, colornames.Brown, p.Shading)
-			colorMask := lerpColor(colorGreen, colorBrown, 1-p.Fertility)
-			plantSprite.DrawColorMask(plantBatch, pixel.IM.Rotated(pixel.ZV, p.Rot).Scaled(pixel.ZV, p.Radius/plantSprite.Frame().W()).Moved(p.Pos).Moved(offset).Scaled(win.Bounds().Center(), scale), colorMask)
+		for _, wc := range worldCopies {
+			copyOffset := offset.Add(wc)
+			copyView := view.Moved(wc.Scaled(-1))
+			for _, p := range env.Plants.Objects {
+				if !isInView(copyView, p.Pos, p.Radius) {
+					continue
+				}
+				colorGreen := lerpColor(colornames.Lightgreen, colornames.Darkgreen, p.Shading)
+				colorBrown := lerpColor(colornames.Yellow, colornames.Brown, p.Shading)
+				colorMask := lerpColor(colorGreen, colorBrown, 1-p.Fertility)
+				plantSprite.DrawColorMask(plantBatch, pixel.IM.Rotated(pixel.ZV, p.Rot).Scaled(pixel.ZV, p.Radius/plantSprite.Frame().W()).Moved(p.Pos).Moved(copyOffset).Scaled(win.Bounds().Center(), scale), colorMask)
+			}
 		}
 		plantBatch.Draw(win)
+		// Dim the world at night
+		if daylight := env.Daylight(); daylight < 1 {
+			imd.Clear()
+			imd.Color = pixel.Alpha(0.7 * (1 - daylight))
+			imd.Push(win.Bounds().Min, win.Bounds().Max)
+			imd.Rectangle(0)
+			imd.Draw(win)
+		}
+		// Draw temperature
+		if isShowingTemperature {
+			drawTemperature(win, imd, env, offset, scale)
+		}
+		// Draw currents
+		if isShowingCurrents {
+			drawCurrents(win, imd, env, offset, scale)
+		}
 
 		// UI
 		// Clear Stats
 		timerText.Clear()
 		numCreaturesText.Clear()
 		// Update Stats
-		fmt.Fprintf(timerText, "Sim Time: %.1f", simTimer.Seconds())
+		fmt.Fprintf(timerText, "Sim Time: %.1f", env.SimTime.Seconds())
+		if GlobalSP.EnvironmentalParams.DayLength > 0 {
+			fmt.Fprintf(timerText, ", Daylight: %.0f%%", env.Daylight()*100)
+		}
+		if season := env.SeasonName(); season != "" {
+			fmt.Fprintf(timerText, ", %s", season)
+		}
 		fmt.Fprintf(numCreaturesText, "Num Creatures: %d\nNum Food: %d", len(env.Creatures.Objects), len(env.Food.Objects))
 		// Draw Stats
 		timerText.Draw(win, pixel.IM.Moved(pixel.V(10, win.Bounds().H()-20)))
 		numCreaturesText.Draw(win, pixel.IM.Moved(pixel.V(10, win.Bounds().H()-40)))
 
+		// Scenario progress. Once the scenario is won or lost, the result stays
+		if currentScenario != nil {
+			if scenarioStatus.State == ScenarioRunning {
+				scenarioStatus = currentScenario.Goal.Evaluate(env)
+			}
+			scenarioText.Clear()
+			switch scenarioStatus.State {
+			case ScenarioWon:
+				scenarioText.Color = colornames.Lime
+			case ScenarioLost:
+				scenarioText.Color = colornames.Red
+			default:
+				scenarioText.Color = colornames.White
+			}
+			fmt.Fprintf(scenarioText, "%s: %s\n%s", currentScenario.Name, currentScenario.Goal.Description, scenarioStatus.Message)
+			scenarioLoc := pixel.V(math.Round(win.Bounds().W()/2-scenarioText.Bounds().W()/2), win.Bounds().H()-20)
+			scenarioText.Draw(win, pixel.IM.Moved(scenarioLoc))
+			// Progress bar
+			barY := scenarioLoc.Y - scenarioText.LineHeight*2 - 2
+			imd.Clear()
+			imd.Color = colornames.Dimgray
+			imd.Push(pixel.V(scenarioLoc.X, barY), pixel.V(scenarioLoc.X+scenarioText.Bounds().W(), barY))
+			imd.Line(4)
+			imd.Color = scenarioText.Color
+			imd.Push(pixel.V(scenarioLoc.X, barY), pixel.V(scenarioLoc.X+scenarioText.Bounds().W()*scenarioStatus.Progress, barY))
+			imd.Line(4)
+			imd.Draw(win)
+		}
+
 		// Creature UI
 		// Find the creature under the mouse
-		mousePos := win.MousePosition().Sub(win.Bounds().Center()).Scaled(1 / scale).Add(win.Bounds().Center()).Sub(offset)
+		mousePos := env.WrapPos(win.MousePosition().Sub(win.Bounds().Center()).Scaled(1 / scale).Add(win.Bounds().Center()).Sub(offset))
 		pressedNumKey := getJustPressedNumKey(win)
-		if win.JustPressed(pixelgl.MouseButtonLeft) {
+		// The number keys pick the tool while painting, so they do not also save or load slots
+		if painter.Active {
+			pressedNumKey = -1
+		}
+		brainBounds := pixel.R(win.Bounds().W()-300, 0, win.Bounds().W(), 400)
+		// Clicks on the brain panel are for the panel, not the world
+		isMouseOnBrainPanel := activeCreature != nil && brainBounds.Contains(win.MousePosition())
+		if painter.Active {
+			if !keyboardCaptured {
+				painter.Update(win, env, terrain, mousePos, 1/60.0, isFeedingAllowed)
+			}
+			instructionsText.Clear()
+			fmt.Fprint(instructionsText, painter.Instructions(isFeedingAllowed))
+			painter.DrawBrush(win, imd, win.MousePosition(), scale)
+		} else if win.JustPressed(pixelgl.MouseButtonLeft) && !isMouseOnBrainPanel {
 			creatureUnderMouse := env.Creatures.Query(mousePos, 1)
 			isActiveGrabbed = false
 			if len(creatureUnderMouse) > 0 {
 				activeCreature = creatureUnderMouse[0]
-				nnimg := vis.DrawImage(activeCreature.DNA.Genotype)
-				nnPic := pixel.PictureDataFromImage(nnimg)
-				currentCreatureBrainSprite = pixel.NewSprite(nnPic, nnPic.Bounds())
+				brainView.SetGenotype(activeCreature.DNA.Genotype, activeCreature.InputNames(), creatureOutputNames)
 			} else {
 				activeCreature = nil
-				currentCreatureBrainSprite = nil
+				isEditingBrain = false
 			}
 		}
-		if activeCreature != nil {
+		if activeCreature != nil && !keyboardCaptured {
 			instructionsText.Clear()
-			fmt.Fprintf(instructionsText, "Sca(t)ter Food, (K)ill, (C)lone, (F)eed, (G)rab, (R)andomize Color, Exp(o)rt Creature, (I)mport Creature, (L)oad Sim Params")
+			fmt.Fprintf(instructionsText, "Sca(t)ter Food, (K)ill, (C)lone, (F)eed, (G)rab, (R)andomize Color, (P)ossess, Edit Brai(n), Exp(o)rt Creature, Save To Librar(y), Copy Code (J), Export Lineage (Shift+Z), Set Diff Base (,), Show Diff (.), E(x)port Brain, (I)mport Creature, (L)oad Sim Params")
 			// Update actions
 			if win.JustPressed(pixelgl.KeyK) {
 				activeCreature.Die(env)
 			}
-			if win.JustPressed(pixelgl.KeyC) {
+			if win.JustPressed(pixelgl.KeyC) && isFeedingAllowed {
 				newDNA := activeCreature.DNA.Copied()
 				newCreature := NewCreature(newDNA)
 				newCreature.Pos = activeCreature.Pos
 				env.Creatures.Add(newCreature)
 			}
-			if win.JustPressed(pixelgl.KeyF) {
+			if win.JustPressed(pixelgl.KeyF) && isFeedingAllowed {
 				activeCreature.Energy = activeCreature.DNA.MaxEnergy()
 			}
 			if win.JustPressed(pixelgl.KeyG) || win.JustPressed(pixelgl.MouseButtonRight) {
@@ -292,6 +450,53 @@ func run() {
 			if win.JustPressed(pixelgl.KeyR) {
 				activeCreature.DNA.Color = RandomHSV()
 			}
+			if win.JustPressed(pixelgl.KeyX) {
+				if err := exportBrain(activeCreature); err != nil {
+					fmt.Println(err)
+				}
+			}
+			if win.JustPressed(pixelgl.KeyP) {
+				if possessedCreature == nil {
+					possessedCreature = activeCreature
+					isActiveGrabbed = false
+					if debugCreatureSensors == 0 {
+						debugCreatureSensors = 1
+					}
+				} else {
+					releasePossession()
+				}
+			}
+			if win.JustPressed(pixelgl.KeyN) {
+				isEditingBrain = !isEditingBrain
+				brainView.SelectedNeuron, brainView.SelectedSynapse = -1, -1
+			}
+			if isEditingBrain {
+				updateBrainEditor(win, activeCreature, brainView, brainBounds)
+				instructionsText.Clear()
+				fmt.Fprintf(instructionsText, "%s\n", brainEditorSelectionInfo(activeCreature, brainView))
+				fmt.Fprintf(instructionsText, "Editing Brain: Click To Select, Click Two Neurons To Connect, (+/-) Weight, (Del)ete Synapse, Add (H)idden Neuron, Change Acti(v)ation, Edit Brai(n) To Finish")
+			}
+			if possessedCreature != nil {
+				instructionsText.Clear()
+				fmt.Fprintf(instructionsText, "Possessed: Arrow Keys To Swim, Space To Attack, F1-F4 Sensors, (P) Release, ")
+				if actionRecorder == nil {
+					fmt.Fprintf(instructionsText, "(B)egin Recording")
+				} else {
+					fmt.Fprintf(instructionsText, "Stop Recording (B) [%d samples]", actionRecorder.Count)
+				}
+				if win.JustPressed(pixelgl.KeyB) {
+					if actionRecorder == nil {
+						recorder, err := startActionRecording(possessedCreature, env)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							actionRecorder = recorder
+						}
+					} else {
+						stopRecording()
+					}
+				}
+			}
 			if win.JustPressed(pixelgl.KeyF1) {
 				debugCreatureSensors = 0
 			}
@@ -309,17 +514,36 @@ func run() {
 				fmt.Fprintf(instructionsText, "Press A Number Key To Save The Creature's DNA To That Slot")
 			}
 			if win.Pressed(pixelgl.KeyO) && pressedNumKey != -1 {
-				serialisedDNA, err := json.MarshalIndent(activeCreature.DNA, "", "  ")
+				library.StartSlotSave(activeCreature.DNA, pressedNumKey)
+			}
+			if win.JustPressed(pixelgl.KeyY) {
+				library.StartSave(activeCreature, env.SimTime)
+			}
+			if win.JustPressed(pixelgl.KeyZ) && (win.Pressed(pixelgl.KeyLeftShift) || win.Pressed(pixelgl.KeyRightShift)) {
+				if err := exportPopulation(env, LineageOf(env, activeCreature), "lineage"); err != nil {
+					fmt.Println(err)
+				}
+			}
+			if win.JustPressed(pixelgl.KeyComma) {
+				base := activeCreature.DNA.Copied()
+				diffBase = &base
+				fmt.Println("Set the diff base, select another creature and press '.' to compare them")
+			}
+			if win.JustPressed(pixelgl.KeyPeriod) {
+				isShowingDiff = !isShowingDiff
+			}
+			if win.JustPressed(pixelgl.KeyJ) {
+				code, err := EncodeCreatureCode(activeCreature.DNA)
 				if err != nil {
 					fmt.Println(err)
 				} else {
-					ensureDataDir()
-					err = os.WriteFile(getSaveSlotPath(pressedNumKey), serialisedDNA, 0644)
-					if err != nil {
-						fmt.Println(err)
-					}
+					setClipboardText(code)
+					fmt.Println("Creature code (copied to the clipboard):")
+					fmt.Println(code)
 				}
 			}
+		}
+		if activeCreature != nil {
 
 			// Draw stats
 			creatureStats.Clear()
@@ -331,10 +555,15 @@ func run() {
 				"Speed ------------- %.2f\n"+
 				"Sight Range ------- %.2f\n"+
 				"Diet -------------- %.2f\n"+
+				"Preferred Temp ---- %.2f\n"+
 				"Plant Efficiency -- %.2f\n"+
 				"Meat Efficiency --- %.2f\n"+
 				"Predator Met Mult - %.2f\n"+
-				"Metabolism -------- %.2f\n",
+				"Metabolism -------- %.2f\n"+
+				"Metabolism Here --- %.2f\n"+
+				"Brain Metabolism -- %.3f\n"+
+				"Trait Mut Rate ---- %.2f\n"+
+				"Synapse Mut Prob -- %.2f\n",
 
 				activeCreature.Energy, activeCreature.DNA.MaxEnergy(),
 				activeCreature.Energy-activeCreature.DNA.DeathEnergy(), activeCreature.DNA.MaxEnergy()-activeCreature.DNA.DeathEnergy(),
@@ -342,24 +571,32 @@ func run() {
 				activeCreature.DNA.Speed,
 				activeCreature.DNA.Vision,
 				activeCreature.DNA.Diet,
+				activeCreature.DNA.PreferredTemperature,
 				activeCreature.DNA.PlantConversionEfficiency(),
 				activeCreature.DNA.MeatConversionEfficiency(),
 				activeCreature.DNA.PredatoryMetabolismMultiplier(),
-				activeCreature.DNA.Metabolism())
+				activeCreature.DNA.Metabolism(),
+				activeCreature.CurrentMetabolism(env),
+				activeCreature.DNA.BrainMetabolism(),
+				activeCreature.DNA.MutationParameters().TraitMutationRate,
+				activeCreature.DNA.MutationParameters().SynapseMutationProbability)
 
 			statsLoc := pixel.V(win.Bounds().W()-250, win.Bounds().H()-20)
+			// On a torus, mark the copy of the creature closest to the middle of the screen
+			viewCentre := win.Bounds().Center().Sub(offset)
+			activeViewPos := viewCentre.Add(env.To(viewCentre, activeCreature.Pos))
 			// Background box
 			imd.Clear()
 			imd.Color = color.RGBA{0, 0, 0, 150}
 			imd.Push(statsLoc.Add(pixel.V(0, 10)))
-			imd.Push(statsLoc.Add(pixel.V(0, -130)))
-			imd.Push(statsLoc.Add(pixel.V(250, -130)))
+			imd.Push(statsLoc.Add(pixel.V(0, -196)))
+			imd.Push(statsLoc.Add(pixel.V(250, -196)))
 			imd.Push(statsLoc.Add(pixel.V(250, 10)))
 			imd.Polygon(0)
 			// Creature circle
 			imd.Color = colornames.White
-			imd.Push(activeCreature.Pos.Add(offset).Sub(win.Bounds().Center()).Scaled(scale).Add(win.Bounds().Center()))
-			imd.Circle(activeCreature.DNA.VisionRange()*scale, 2)
+			imd.Push(activeViewPos.Add(offset).Sub(win.Bounds().Center()).Scaled(scale).Add(win.Bounds().Center()))
+			imd.Circle(activeCreature.DNA.VisionRange()*env.LightAt(activeCreature.Pos)*scale, 2)
 			imd.Draw(win)
 			// Debug Sensors
 			if debugCreatureSensors != 0 {
@@ -379,8 +616,8 @@ func run() {
 				}
 				for i := range activeCreature.sensorAngles {
 					imd.Color = lerpColor(sensorOffColor, colornames.Red, sensorValues[i])
-					imd.Push(activeCreature.Pos.Add(offset).Sub(win.Bounds().Center()).Scaled(scale).Add(win.Bounds().Center()))
-					imd.Push(activeCreature.Pos.Add(pixel.V(0, 10).Rotated(activeCreature.sensorAngles[i] + activeCreature.Rot)).Add(offset).Sub(win.Bounds().Center()).Scaled(scale).Add(win.Bounds().Center()))
+					imd.Push(activeViewPos.Add(offset).Sub(win.Bounds().Center()).Scaled(scale).Add(win.Bounds().Center()))
+					imd.Push(activeViewPos.Add(pixel.V(0, 10).Rotated(activeCreature.sensorAngles[i] + activeCreature.Rot)).Add(offset).Sub(win.Bounds().Center()).Scaled(scale).Add(win.Bounds().Center()))
 					imd.Line(2)
 				}
 				imd.Draw(win)
@@ -391,45 +628,66 @@ func run() {
 			// Draw neural network
 			imd.Clear()
 			imd.Color = color.RGBA{0, 0, 0, 150}
-			imd.Push(pixel.V(win.Bounds().W()-200, 400))
-			imd.Push(pixel.V(win.Bounds().W()-200, 0))
-			imd.Push(pixel.V(win.Bounds().W(), 0))
-			imd.Push(pixel.V(win.Bounds().W(), 400))
+			brainPanelCorners := brainBounds.Vertices()
+			imd.Push(brainPanelCorners[:]...)
 			imd.Polygon(0)
 			imd.Draw(win)
-			currentCreatureBrainSprite.Draw(win, pixel.IM.Scaled(pixel.ZV, 0.5).Moved(pixel.V(win.Bounds().W()-100, 200)))
+			brainView.Draw(win, imd, brainBounds, activeCreature.phenotype.Values())
+
+			// Draw the diff against the diff base
+			if isShowingDiff {
+				diffText.Clear()
+				fmt.Fprintln(diffText, "Diff: base (A) -> selected (B)")
+				if diffBase == nil {
+					fmt.Fprint(diffText, "Select a creature and press ',' to set the base")
+				} else {
+					DiffGenomes(*diffBase, activeCreature.DNA, DefaultCompatibilityCoefficients).WriteSummary(diffText)
+				}
+				diffLoc := pixel.V(10, win.Bounds().H()/2+diffText.Bounds().H()/2)
+				imd.Clear()
+				imd.Color = color.RGBA{0, 0, 0, 150}
+				diffPanel := diffText.Bounds().Moved(diffLoc)
+				diffCorners := pixel.R(diffPanel.Min.X-5, diffPanel.Min.Y-5, diffPanel.Max.X+5, diffPanel.Max.Y+5).Vertices()
+				imd.Push(diffCorners[:]...)
+				imd.Polygon(0)
+				imd.Draw(win)
+				diffText.Draw(win, pixel.IM.Moved(diffLoc))
+			}
 
 		}
 
 		// Check for import
-		if win.Pressed(pixelgl.KeyI) {
+		if win.Pressed(pixelgl.KeyI) && !keyboardCaptured {
 			instructionsText.Clear()
 			fmt.Fprintf(instructionsText, "Press A Number Key To Load A Creature's DNA From That Slot")
 		}
-		if win.Pressed(pixelgl.KeyI) && pressedNumKey != -1 {
-			serialisedDNA, err := os.ReadFile(getSaveSlotPath(pressedNumKey))
-			if err != nil {
+		if win.Pressed(pixelgl.KeyI) && pressedNumKey != -1 && !keyboardCaptured && isFeedingAllowed {
+			if _, err := os.Stat(getSaveSlotPath(pressedNumKey)); err != nil {
 				fmt.Println("No creature DNA file found")
 			} else {
-				var dna CreatureDNA
-				dna.Genotype = goevo.NewGenotypeEmpty()
-				err = json.Unmarshal(serialisedDNA, &dna)
+				dna, err := LoadDNAFile(getSaveSlotPath(pressedNumKey))
 				if err != nil {
 					fmt.Println(err)
 				} else {
-					activeCreature = NewCreature(dna)
-					env.Creatures.Add(activeCreature)
-					isActiveGrabbed = true
-					nnimg := vis.DrawImage(activeCreature.DNA.Genotype)
-					nnPic := pixel.PictureDataFromImage(nnimg)
-					currentCreatureBrainSprite = pixel.NewSprite(nnPic, nnPic.Bounds())
+					fmt.Println("Counter was", gtCounter.c)
+					spawnImported(dna)
+					fmt.Println("Counter is", gtCounter.c)
 				}
-				fmt.Println("Counter was", gtCounter.c)
-				gtCounter.SafeWith(dna.Genotype)
-				fmt.Println("Counter is", gtCounter.c)
 			}
 		}
 
+		// Prompts
+		if library.IsOpen() {
+			library.Draw(win, imd)
+			instructionsText.Clear()
+			fmt.Fprintf(instructionsText, "%s", library.Instructions())
+		}
+		if codePrompt.IsOpen() {
+			codePrompt.Draw(win, imd)
+			instructionsText.Clear()
+			fmt.Fprintf(instructionsText, "%s", codePrompt.Instructions())
+		}
+
 		// Draw instructions
 		instructionsText.Draw(win, pixel.IM.Moved(pixel.V(math.Round(win.Bounds().W()/2-instructionsText.Bounds().Center().X), 5)))
 
@@ -482,6 +740,24 @@ func getPlantSprite() (*pixel.Sprite, pixel.Picture) {
 	return pixel.NewSprite(pic, pic.Bounds()), pic
 }
 
+// The brain outputs (turn, power, attack) the player is choosing for a possessed creature
+func getKeyboardCreatureOutput(win *pixelgl.Window) []float64 {
+	turn, power, attack := 0.0, -1.0, -1.0
+	if win.Pressed(pixelgl.KeyLeft) {
+		turn += 1
+	}
+	if win.Pressed(pixelgl.KeyRight) {
+		turn -= 1
+	}
+	if win.Pressed(pixelgl.KeyUp) {
+		power = 1
+	}
+	if win.Pressed(pixelgl.KeySpace) {
+		attack = 1
+	}
+	return []float64{turn, power, attack}
+}
+
 func getJustPressedNumKey(win *pixelgl.Window) int {
 	if win.JustPressed(pixelgl.Key1) {
 		return 1
@@ -518,12 +794,28 @@ func getSaveSlotPath(slot int) string {
 	return "data/creature_dna_" + strconv.Itoa(slot) + ".json"
 }
 
+func getBrainExportPath(name, ext string) string {
+	return "data/brains/" + name + "." + ext
+}
+
+func getBrainGoExportPath(name string) string {
+	return "data/brains/" + name + "/" + name + ".go"
+}
+
+func getRecordingPath(name string) string {
+	return "data/recordings/" + name + ".jsonl"
+}
+
 func getParamsPath() string {
 	return "data/simulation_params.json"
 }
 
 func reloadSimParams() error {
-	data, err := os.ReadFile(getParamsPath())
+	return loadSimParams(getParamsPath())
+}
+
+func loadSimParams(path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
@@ -531,5 +823,146 @@ func reloadSimParams() error {
 	if err != nil {
 		return err
 	}
+	if err := GlobalSP.Timeline.Validate(); err != nil {
+		GlobalSP.Timeline = nil
+		return fmt.Errorf("invalid timeline in %s: %v", path, err)
+	}
+	return nil
+}
+
+// Write the brain of `c` to the brains folder, both as a DOT graph and as standalone Go code
+func exportBrain(c *Creature) error {
+	if err := os.MkdirAll("data/brains", 0755); err != nil {
+		return err
+	}
+	// Add a number to the name if a brain was already exported this second, so that it is not overwritten
+	base := "brain_" + strconv.FormatInt(time.Now().Unix(), 10)
+	name := base
+	for n := 2; ; n++ {
+		_, dotErr := os.Stat(getBrainExportPath(name, "dot"))
+		_, goErr := os.Stat(filepath.Dir(getBrainGoExportPath(name)))
+		if errors.Is(dotErr, os.ErrNotExist) && errors.Is(goErr, os.ErrNotExist) {
+			break
+		}
+		name = base + "_" + strconv.Itoa(n)
+	}
+	dot := BrainToDOT(c.DNA.Genotype, c.InputNames(), creatureOutputNames)
+	if err := os.WriteFile(getBrainExportPath(name, "dot"), []byte(dot), 0644); err != nil {
+		return err
+	}
+	// Each Go export is its own package in its own folder, so that several exported brains can be used in the same program
+	goPath := getBrainGoExportPath(name)
+	src, err := BrainToGo(c.DNA.Genotype, goPackageName(name), c.InputNames(), creatureOutputNames)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(goPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(goPath, []byte(src), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Exported brain to", getBrainExportPath(name, "dot"), "and", goPath)
 	return nil
 }
+
+// Start recording the sensors of a possessed creature along with the actions chosen for it, for imitation learning
+func startActionRecording(c *Creature, env *Environment) (*ActionRecorder, error) {
+	if err := os.MkdirAll("data/recordings", 0755); err != nil {
+		return nil, err
+	}
+	path := getRecordingPath("recording_" + strconv.FormatInt(time.Now().Unix(), 10))
+	recorder, err := NewActionRecorder(path)
+	if err != nil {
+		return nil, err
+	}
+	c.inputHook = func(inputs []float64) {
+		err := recorder.Record(ActionSample{
+			SimTime: env.SimTime.Seconds(),
+			Inputs:  append([]float64{}, inputs...),
+			Outputs: append([]float64{}, c.possessedOutput...),
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	fmt.Println("Recording to", path)
+	return recorder, nil
+}
+
+// Draw an arrow showing the current at each point of a grid over the visible part of the world
+// Whether any of a circle at `pos` with `radius` can be inside `view`
+func isInView(view pixel.Rect, pos pixel.Vec, radius float64) bool {
+	return pos.X+radius >= view.Min.X && pos.X-radius <= view.Max.X && pos.Y+radius >= view.Min.Y && pos.Y-radius <= view.Max.Y
+}
+
+func drawCurrents(win *pixelgl.Window, imd *imdraw.IMDraw, env *Environment, offset pixel.Vec, scale float64) {
+	strength := GlobalSP.EnvironmentalParams.CurrentStrength
+	if strength == 0 {
+		return
+	}
+	center := win.Bounds().Center()
+	toWorld := func(p pixel.Vec) pixel.Vec {
+		return p.Sub(center).Scaled(1 / scale).Add(center).Sub(offset)
+	}
+	toScreen := func(p pixel.Vec) pixel.Vec {
+		return p.Add(offset).Sub(center).Scaled(scale).Add(center)
+	}
+	min, max := toWorld(win.Bounds().Min), toWorld(win.Bounds().Max)
+	// Keep the number of arrows about the same at any zoom
+	step := math.Max(5, math.Round((max.X-min.X)/40))
+	t := env.SimTime.Seconds()
+	imd.Clear()
+	imd.Color = color.RGBA{255, 255, 255, 80}
+	for x := math.Floor(min.X/step) * step; x < max.X; x += step {
+		for y := math.Floor(min.Y/step) * step; y < max.Y; y += step {
+			p := pixel.V(x, y)
+			if !env.InsideMap(p) || env.sampleWallAt(p, false) {
+				continue
+			}
+			v := env.Currents.At(env.WrapPos(p), t).Scaled(step * 0.4 / strength)
+			if v.Len() > step*0.9 {
+				v = v.Unit().Scaled(step * 0.9)
+			}
+			tip := toScreen(p.Add(v))
+			imd.Push(toScreen(p), tip)
+			imd.Line(1)
+			// Arrow head
+			back := v.Unit().Scaled(-step * 0.15 * scale)
+			imd.Push(tip, tip.Add(back.Rotated(0.5)))
+			imd.Line(1)
+			imd.Push(tip, tip.Add(back.Rotated(-0.5)))
+			imd.Line(1)
+		}
+	}
+	imd.Draw(win)
+}
+
+// Draw the temperature of the visible water as a heatmap, from blue for cold to red for hot
+func drawTemperature(win *pixelgl.Window, imd *imdraw.IMDraw, env *Environment, offset pixel.Vec, scale float64) {
+	center := win.Bounds().Center()
+	toWorld := func(p pixel.Vec) pixel.Vec {
+		return p.Sub(center).Scaled(1 / scale).Add(center).Sub(offset)
+	}
+	toScreen := func(p pixel.Vec) pixel.Vec {
+		return p.Add(offset).Sub(center).Scaled(scale).Add(center)
+	}
+	min, max := toWorld(win.Bounds().Min), toWorld(win.Bounds().Max)
+	// Keep the number of cells about the same at any zoom
+	step := math.Max(2, math.Round((max.X-min.X)/80))
+	t := env.SimTime.Seconds()
+	imd.Clear()
+	for x := math.Floor(min.X/step) * step; x < max.X; x += step {
+		for y := math.Floor(min.Y/step) * step; y < max.Y; y += step {
+			p := pixel.V(x, y)
+			if !env.InsideMap(p) {
+				continue
+			}
+			col := lerpColor(colornames.Blue, colornames.Red, env.Temperature.At(env.WrapPos(p), t))
+			imd.Color = pixel.ToRGBA(col).Mul(pixel.Alpha(0.4))
+			imd.Push(toScreen(p.Sub(pixel.V(step/2, step/2))), toScreen(p.Add(pixel.V(step/2, step/2))))
+			imd.Rectangle(0)
+		}
+	}
+	imd.Draw(win)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+// Maps can be saved as two PNG images with one pixel per texel, where the top of the image is the top of the map.
+// In the wall image, dark pixels are walls and light pixels are water.
+// In the plant image, plants grow on pixels that are more green than red or blue, and how bright the green is sets both how likely a plant is to grow there and its fertility
+
+// Load the walls of a map from a PNG, stretching it to fit a map of `radius`
+func LoadWallImage(path string, radius int) (*WallGrid, error) {
+	img, err := loadPNG(path)
+	if err != nil {
+		return nil, err
+	}
+	size := radius * 2
+	return NewWallGrid(size, func(i, j int) bool {
+		r, g, b, a := sampleImage(img, i, size-j-1, size).RGBA()
+		// Transparent pixels are walls too, so that the outside of a drawing of a map is closed off
+		brightness := float64(r+g+b) / 3 / 0xffff
+		return a < 0x8000 || brightness < 0.5
+	}), nil
+}
+
+// Load the plants of a map from a PNG, stretching it to fit a map of `radius`.
+// A plant grows on each pixel that is not a wall and is mostly green with a chance of `density` times the brightness of the green
+func (env *Environment) LoadPlantImage(path string, density float64) error {
+	img, err := loadPNG(path)
+	if err != nil {
+		return err
+	}
+	size := env.Radius * 2
+	env.Plants = NewHashMap[*Plant](10)
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			r, g, b, a := sampleImage(img, i, size-j-1, size).RGBA()
+			// White and grey pixels have as much green as anything else, so are not plants
+			if g <= r || g <= b || a == 0 {
+				continue
+			}
+			green := float64(g) / float64(a)
+			p := pixel.V(float64(i-env.Radius), float64(j-env.Radius))
+			if env.sampleWallAt(p, true) || rand.Float64() >= density*green {
+				continue
+			}
+			env.Plants.Add(&Plant{
+				Pos:       p,
+				Radius:    3 + rand.Float64()*2,
+				Rot:       rand.Float64() * 2 * math.Pi,
+				Shading:   rand.Float64()*0.5 + 0.5,
+				Fertility: green,
+			})
+		}
+	}
+	env.Plants.Refresh()
+	return nil
+}
+
+// Save the walls of the map as a PNG, with black walls and white water
+func (env *Environment) SaveWallImage(path string) error {
+	size := env.TexelsWall.Size()
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			if !env.TexelsWall.At(i, j) {
+				img.SetGray(i, size-j-1, color.Gray{255})
+			}
+		}
+	}
+	return savePNG(path, img)
+}
+
+// Save the plants of the map as a PNG, with a green pixel for each plant that is as bright as the plant is fertile
+func (env *Environment) SavePlantImage(path string) error {
+	size := env.Radius * 2
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			img.SetRGBA(i, j, color.RGBA{0, 0, 0, 255})
+		}
+	}
+	for _, p := range env.Plants.Objects {
+		i, j := int(math.Round(p.Pos.X))+env.Radius, int(math.Round(p.Pos.Y))+env.Radius
+		if i < 0 || j < 0 || i >= size || j >= size {
+			continue
+		}
+		// Keep a little green so that infertile plants are not lost
+		g := uint8(math.Max(math.Round(p.Fertility*255), 1))
+		img.SetRGBA(i, size-j-1, color.RGBA{0, g, 0, 255})
+	}
+	return savePNG(path, img)
+}
+
+// Save the walls and plants of the map to the maps folder, returning the path of the wall image
+func exportMap(env *Environment, name string) (string, error) {
+	if err := os.MkdirAll("data/maps", 0755); err != nil {
+		return "", err
+	}
+	wallPath, plantPath := getMapImagePaths(name + "_" + fmt.Sprint(time.Now().Unix()))
+	if err := env.SaveWallImage(wallPath); err != nil {
+		return "", err
+	}
+	if err := env.SavePlantImage(plantPath); err != nil {
+		return "", err
+	}
+	fmt.Println("Exported map to", wallPath, "and", plantPath)
+	return wallPath, nil
+}
+
+func getMapImagePaths(name string) (string, string) {
+	return "data/maps/" + name + "_walls.png", "data/maps/" + name + "_plants.png"
+}
+
+// Generate a map from the params and save it as images, without running the sim
+func mapCommand(args []string) error {
+	fs := flag.NewFlagSet("map", flag.ContinueOnError)
+	seed := fs.Int64("seed", 0, "seed of the map (0 picks a random seed)")
+	name := fs.String("name", "map", "name to start the image file names with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("unexpected arguments")
+	}
+	if *seed != 0 {
+		rand.Seed(*seed)
+	}
+	_, err := exportMap(NewEnvironment(GlobalSP.MapParams.MapRadius), *name)
+	return err
+}
+
+func loadPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return img, nil
+}
+
+func savePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// The colour of the pixel of `img` at (x, y) when the image is stretched to a square `size` pixels wide, where (0, 0) is the top left
+func sampleImage(img image.Image, x, y, size int) color.Color {
+	b := img.Bounds()
+	return img.At(b.Min.X+x*b.Dx()/size, b.Min.Y+y*b.Dy()/size)
+}
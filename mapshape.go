@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+)
+
+// The shapes the map can be
+const (
+	ShapeCircle    = "circle"    // A circle of the map radius surrounded by walls
+	ShapeRectangle = "rectangle" // A square as wide as the map diameter surrounded by walls
+	ShapeTorus     = "torus"     // A square as wide as the map diameter where each edge wraps around to the opposite edge
+)
+
+// Check that `shape` is one of the map shapes, treating an empty shape as a circle
+func parseMapShape(shape string) (string, error) {
+	switch shape {
+	case ShapeCircle, "":
+		return ShapeCircle, nil
+	case ShapeRectangle, ShapeTorus:
+		return shape, nil
+	}
+	return ShapeCircle, fmt.Errorf("unknown map shape '%s', expected one of %s, %s or %s", shape, ShapeCircle, ShapeRectangle, ShapeTorus)
+}
+
+// How far (x, y) is from the middle of a map of `shape`, measured so that the edge of the map is at the map radius
+func edgeDistance(shape string, x, y float64) float64 {
+	if shape == ShapeCircle {
+		return math.Hypot(x, y)
+	}
+	return math.Max(math.Abs(x), math.Abs(y))
+}
+
+// Whether creatures that leave one edge of the map come back in at the other
+func (e *Environment) Wraps() bool {
+	return e.Shape == ShapeTorus
+}
+
+// Move a position that has left a torus map back onto it. Positions on other maps are unchanged
+func (e *Environment) WrapPos(p pixel.Vec) pixel.Vec {
+	if !e.Wraps() {
+		return p
+	}
+	r, size := float64(e.Radius), float64(e.Radius*2)
+	return pixel.V(p.X-size*math.Floor((p.X+r)/size), p.Y-size*math.Floor((p.Y+r)/size))
+}
+
+// The shortest vector from `a` to `b`, which on a torus map may cross an edge
+func (e *Environment) To(a, b pixel.Vec) pixel.Vec {
+	d := b.Sub(a)
+	if !e.Wraps() {
+		return d
+	}
+	size := float64(e.Radius * 2)
+	return pixel.V(wrapDelta(d.X, size), wrapDelta(d.Y, size))
+}
+
+// Move the difference `d` between two positions on a loop of length `size` to the shortest way round, between -size/2 and size/2
+func wrapDelta(d, size float64) float64 {
+	return d - size*math.Floor((d+size/2)/size)
+}
+
+// How deep `p` is, from 0 in the middle of the map to 1 at the edge.
+// A torus has no edge to be deep towards, so all of it is as shallow as the middle
+func (e *Environment) Depth(p pixel.Vec) float64 {
+	return shapeDepth(e.Shape, float64(e.Radius), p)
+}
+
+func shapeDepth(shape string, radius float64, p pixel.Vec) float64 {
+	if shape == ShapeTorus {
+		return 0
+	}
+	return edgeDistance(shape, p.X, p.Y) / radius
+}
+
+// Sample `noise` so that it repeats every `period` in x and y, which is used to make noise match up across the edges of a torus.
+// Near the far edges of each period the noise is blended with its copies a period back, so that it runs smoothly into the noise at the near edges
+func periodicNoise(noise func(x, y float64) float64, x, y, period float64) float64 {
+	x, y = x-period*math.Floor(x/period), y-period*math.Floor(y/period)
+	band := period / 8
+	// The weights go from 1 away from the far edges to 0 at them, along a smoothstep
+	weight := func(v float64) float64 {
+		t := math.Min((period-v)/band, 1)
+		return t * t * (3 - 2*t)
+	}
+	wx, wy := weight(x), weight(y)
+	if wx == 1 && wy == 1 {
+		return noise(x, y)
+	}
+	return wx*wy*noise(x, y) + (1-wx)*wy*noise(x-period, y) + wx*(1-wy)*noise(x, y-period) + (1-wx)*(1-wy)*noise(x-period, y-period)
+}
+
+// Whether `p` is within the edge of the map. Every position is on a torus map, as it wraps around
+func (e *Environment) InsideMap(p pixel.Vec) bool {
+	return e.Wraps() || edgeDistance(e.Shape, p.X, p.Y) <= float64(e.Radius)
+}
+
+// The area of water and walls inside the edge of the map
+func (e *Environment) Area() float64 {
+	r := float64(e.Radius)
+	if e.Shape == ShapeCircle {
+		return math.Pi * r * r
+	}
+	return 4 * r * r
+}
+
+// A uniformly random position within `dist` of the middle of the map, measured the way the map's edge is
+func (e *Environment) randomPos(dist float64) pixel.Vec {
+	if e.Shape == ShapeCircle {
+		return pixel.V(math.Sqrt(rand.Float64())*dist, 0).Rotated(rand.Float64() * 2 * math.Pi)
+	}
+	return pixel.V((rand.Float64()*2-1)*dist, (rand.Float64()*2-1)*dist)
+}
+
+// The offsets of every copy of a torus map that can be seen between `min` and `max` in world space, so that the map can be drawn tiled.
+// Maps that do not wrap only have the one copy
+func (e *Environment) VisibleCopies(min, max pixel.Vec) []pixel.Vec {
+	if !e.Wraps() {
+		return []pixel.Vec{pixel.ZV}
+	}
+	r, size := float64(e.Radius), float64(e.Radius*2)
+	copies := make([]pixel.Vec, 0, 4)
+	for cx := math.Floor((min.X + r) / size); cx <= math.Floor((max.X+r)/size); cx++ {
+		for cy := math.Floor((min.Y + r) / size); cy <= math.Floor((max.Y+r)/size); cy++ {
+			copies = append(copies, pixel.V(cx*size, cy*size))
+		}
+	}
+	return copies
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/pixelgl"
+	"golang.org/x/image/colornames"
+)
+
+// The things that can be painted onto the world
+const (
+	PaintWalls = iota
+	PaintPlants
+	PaintFertility
+	PaintFood
+)
+
+var paintToolNames = []string{"Walls", "Plants", "Fertility", "Food"}
+
+// Brush tools for shaping the world while the sim runs.
+// The left mouse button paints the chosen thing and the right mouse button erases it
+type WorldPainter struct {
+	Active    bool
+	Tool      int
+	BrushSize float64 // The radius of the brush in world units
+}
+
+func NewWorldPainter() *WorldPainter {
+	return &WorldPainter{
+		Tool:      PaintWalls,
+		BrushSize: 5,
+	}
+}
+
+// Handle the painting controls, painting at the world position `mousePos`.
+// Any walls that change are redrawn by `terrain`. If `feedingAllowed` is false, only walls can be painted, as the other tools would add or change food
+func (p *WorldPainter) Update(win *pixelgl.Window, env *Environment, terrain *TerrainRenderer, mousePos pixel.Vec, deltaTime float64, feedingAllowed bool) {
+	for i, key := range []pixelgl.Button{pixelgl.Key1, pixelgl.Key2, pixelgl.Key3, pixelgl.Key4} {
+		if win.JustPressed(key) {
+			p.Tool = i
+		}
+	}
+	if win.JustPressed(pixelgl.KeyLeftBracket) {
+		p.BrushSize /= 1.25
+	}
+	if win.JustPressed(pixelgl.KeyRightBracket) {
+		p.BrushSize *= 1.25
+	}
+	p.BrushSize *= math.Pow(1.1, win.MouseScroll().Y)
+	p.BrushSize = math.Min(math.Max(p.BrushSize, 0.5), 200)
+
+	isPainting, isErasing := win.Pressed(pixelgl.MouseButtonLeft), win.Pressed(pixelgl.MouseButtonRight)
+	if isPainting == isErasing || (!feedingAllowed && p.Tool != PaintWalls) {
+		return
+	}
+	switch p.Tool {
+	case PaintWalls:
+		if minI, minJ, maxI, maxJ, changed := env.PaintWalls(mousePos, p.BrushSize, isPainting); changed {
+			terrain.Invalidate(minI, minJ, maxI, maxJ)
+		}
+	case PaintPlants:
+		if isPainting {
+			env.AddPlants(mousePos, p.BrushSize, GlobalSP.MapParams.PlantDensity*deltaTime)
+		} else {
+			env.RemovePlants(mousePos, p.BrushSize)
+		}
+	case PaintFertility:
+		// It takes a second of painting to go from infertile to fully fertile
+		change := deltaTime
+		if isErasing {
+			change = -change
+		}
+		env.ChangeFertility(mousePos, p.BrushSize, change)
+	case PaintFood:
+		if isPainting {
+			env.AddFood(mousePos, p.BrushSize, 0.05*deltaTime)
+		} else {
+			env.RemoveFood(mousePos, p.BrushSize)
+		}
+	}
+}
+
+func (p *WorldPainter) Instructions(feedingAllowed bool) string {
+	if !feedingAllowed && p.Tool != PaintWalls {
+		return fmt.Sprintf("Painting %s Is Not Allowed In This Scenario, 1 To Paint Walls, Stop Painting (F8)", paintToolNames[p.Tool])
+	}
+	return fmt.Sprintf("Painting %s (Brush %.1f): Left Click To Paint, Right Click To Erase, 1-4 Walls/Plants/Fertility/Food, [ ] Or Scroll Brush Size, Stop Painting (F8)", paintToolNames[p.Tool], p.BrushSize)
+}
+
+// Draw the outline of the brush around the screen position `pos`
+func (p *WorldPainter) DrawBrush(win *pixelgl.Window, imd *imdraw.IMDraw, pos pixel.Vec, scale float64) {
+	imd.Clear()
+	imd.Color = colornames.White
+	imd.Push(pos)
+	imd.Circle(p.BrushSize*scale, 1)
+	imd.Draw(win)
+}
+
+// Make every texel within `radius` of `pos` a wall if `isWall`, or water if not.
+// Returns the range of texels that changed, and whether any did
+func (env *Environment) PaintWalls(pos pixel.Vec, radius float64, isWall bool) (minI, minJ, maxI, maxJ int, changed bool) {
+	minI, minJ = math.MaxInt, math.MaxInt
+	maxI, maxJ = -1, -1
+	ci, cj := env.worldPosToMapPos(pos)
+	r := int(math.Ceil(radius))
+	size := env.TexelsWall.Size()
+	for bi := ci - r; bi <= ci+r; bi++ {
+		for bj := cj - r; bj <= cj+r; bj++ {
+			if math.Hypot(float64(bi-ci), float64(bj-cj)) > radius {
+				continue
+			}
+			// On a torus the brush wraps around to the other side of the map
+			i, j := bi, bj
+			if env.Wraps() {
+				i, j = ((i%size)+size)%size, ((j%size)+size)%size
+			}
+			if i < 0 || j < 0 || i >= size || j >= size || env.TexelsWall.At(i, j) == isWall {
+				continue
+			}
+			env.TexelsWall.Set(i, j, isWall)
+			minI, minJ = minInt(minI, i), minInt(minJ, j)
+			maxI, maxJ = maxInt(maxI, i), maxInt(maxJ, j)
+			changed = true
+		}
+	}
+	// Plants cannot grow inside rock, food inside it is buried, and creatures are pushed out to the nearest water
+	if changed && isWall {
+		inNewRock := func(p pixel.Vec, r float64) bool {
+			return env.To(p, pos).Len() <= radius+r+2 && env.sampleWallAt(p, false)
+		}
+		env.removePlantsWhere(func(p *Plant) bool {
+			return inNewRock(p.Pos, 0)
+		})
+		kept := make([]*Food, 0, len(env.Food.Objects))
+		for _, f := range env.Food.Objects {
+			if !inNewRock(f.Pos, 0) {
+				kept = append(kept, f)
+			}
+		}
+		env.Food.Objects = kept
+		env.Food.Refresh()
+		for _, c := range env.Creatures.Objects {
+			if inNewRock(c.Pos, c.Radius) {
+				c.Pos = env.nearestOpenPos(c.Pos)
+				c.Vel = pixel.ZV
+			}
+		}
+	}
+	return minI, minJ, maxI, maxJ, changed
+}
+
+// The nearest position to `p` that is not inside a wall, searching outwards in rings. If there is none nearby, `p` is returned
+func (env *Environment) nearestOpenPos(p pixel.Vec) pixel.Vec {
+	for dist := 1.0; dist <= 50; dist++ {
+		steps := int(math.Ceil(2 * math.Pi * dist))
+		for k := 0; k < steps; k++ {
+			q := p.Add(pixel.V(dist, 0).Rotated(2 * math.Pi * float64(k) / float64(steps)))
+			if env.InsideMap(q) && !env.sampleWallAt(q, false) {
+				return env.WrapPos(q)
+			}
+		}
+	}
+	return p
+}
+
+// Grow new plants at random open positions within `radius` of `pos`, with `density` plants per unit area
+func (env *Environment) AddPlants(pos pixel.Vec, radius, density float64) {
+	for _, p := range randomPointsInCircle(pos, radius, density) {
+		if env.sampleWallAt(p, true) {
+			continue
+		}
+		env.Plants.Add(&Plant{
+			Pos:       env.WrapPos(p),
+			Radius:    3 + rand.Float64()*2,
+			Rot:       rand.Float64() * 2 * math.Pi,
+			Shading:   rand.Float64()*0.5 + 0.5,
+			Fertility: 0.5,
+		})
+	}
+	env.Plants.Refresh()
+}
+
+// Remove every plant within `radius` of `pos`
+func (env *Environment) RemovePlants(pos pixel.Vec, radius float64) {
+	env.removePlantsWhere(func(p *Plant) bool {
+		return env.To(p.Pos, pos).Len() <= radius
+	})
+}
+
+// Change the fertility of every plant within `radius` of `pos` by `change`, keeping it between 0 and 1
+func (env *Environment) ChangeFertility(pos pixel.Vec, radius, change float64) {
+	for _, p := range env.Plants.Query(pos, radius) {
+		p.Fertility = math.Min(math.Max(p.Fertility+change, 0), 1)
+	}
+}
+
+// Drop new food at random open positions within `radius` of `pos`, with `density` food per unit area
+func (env *Environment) AddFood(pos pixel.Vec, radius, density float64) {
+	for _, p := range randomPointsInCircle(pos, radius, density) {
+		if env.sampleWallAt(p, false) {
+			continue
+		}
+		f := NewFood(rand.Float64()*2+1, true)
+		f.Pos = env.WrapPos(p)
+		f.Rot = rand.Float64() * 2 * math.Pi
+		env.Food.Add(f)
+	}
+}
+
+// Remove every food within `radius` of `pos`
+func (env *Environment) RemoveFood(pos pixel.Vec, radius float64) {
+	for _, f := range env.Food.Query(pos, radius) {
+		env.Food.Remove(f)
+	}
+}
+
+func (env *Environment) removePlantsWhere(shouldRemove func(p *Plant) bool) {
+	kept := make([]*Plant, 0, len(env.Plants.Objects))
+	for _, p := range env.Plants.Objects {
+		if !shouldRemove(p) {
+			kept = append(kept, p)
+		}
+	}
+	env.Plants.Objects = kept
+	env.Plants.Refresh()
+}
+
+// Random points within `radius` of `pos`, with `density` points per unit area on average
+func randomPointsInCircle(pos pixel.Vec, radius, density float64) []pixel.Vec {
+	expected := density * math.Pi * radius * radius
+	n := int(expected)
+	if rand.Float64() < expected-float64(n) {
+		n++
+	}
+	points := make([]pixel.Vec, n)
+	for i := range points {
+		points[i] = pos.Add(pixel.V(math.Sqrt(rand.Float64())*radius, 0).Rotated(rand.Float64() * 2 * math.Pi))
+	}
+	return points
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JoshPattman/goevo"
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// Ways of choosing where seeded creatures spawn
+const (
+	SpawnCentre    = "centre"    // Anywhere in the open area in the middle of the map
+	SpawnRandom    = "random"    // Anywhere on the map that is not a wall
+	SpawnClustered = "clustered" // All creatures made from the same genome spawn together, at a random open spot
+	SpawnSaved     = "saved"     // Where the creature was when its archive was saved, or in the centre if it was not saved in an archive
+)
+
+// A set of creatures used to seed a world
+type PopulationSource struct {
+	Path  string `json:"path"`  // A population archive, a DNA file, or a directory of DNA files. If empty, random creatures are made
+	Count int    `json:"count"` // The number of creatures made from each genome. If 0, each creature in an archive is spawned once, and `initial_creatures_number` random creatures are made
+	Spawn string `json:"spawn"` // Where to spawn the creatures, one of "centre", "random", "clustered" or "saved"
+}
+
+// A creature saved in a population archive
+type ArchivedCreature struct {
+	DNA    CreatureDNA `json:"dna"`
+	X      float64     `json:"x"`
+	Y      float64     `json:"y"`
+	Rot    float64     `json:"rot"`
+	Energy float64     `json:"energy"`
+}
+
+// Many creatures saved together, so that a whole population can be moved between worlds
+type PopulationArchive struct {
+	SavedAt   time.Time          `json:"saved_at"`
+	SimTime   float64            `json:"sim_time"`
+	MapRadius int                `json:"map_radius"`
+	Creatures []ArchivedCreature `json:"creatures"`
+}
+
+// Create an archive of `creatures` from `env`
+func NewPopulationArchive(env *Environment, creatures []*Creature) PopulationArchive {
+	a := PopulationArchive{
+		SavedAt:   time.Now(),
+		SimTime:   env.SimTime.Seconds(),
+		MapRadius: env.Radius,
+		Creatures: make([]ArchivedCreature, 0, len(creatures)),
+	}
+	for _, c := range creatures {
+		a.Creatures = append(a.Creatures, ArchivedCreature{
+			DNA:    c.DNA,
+			X:      c.Pos.X,
+			Y:      c.Pos.Y,
+			Rot:    c.Rot,
+			Energy: c.Energy,
+		})
+	}
+	return a
+}
+
+// The living creatures of `env` that are in the same lineage as `c`
+func LineageOf(env *Environment, c *Creature) []*Creature {
+	lineage := make([]*Creature, 0)
+	for _, o := range env.Creatures.Objects {
+		if o == c || (c.DNA.Lineage != 0 && o.DNA.Lineage == c.DNA.Lineage) {
+			lineage = append(lineage, o)
+		}
+	}
+	return lineage
+}
+
+// Write an archive as gzipped JSON
+func SavePopulationArchive(path string, a PopulationArchive) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := gzip.NewWriter(f)
+	if err := json.NewEncoder(w).Encode(a); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Read an archive, which may be gzipped or plain JSON
+func LoadPopulationArchive(path string) (PopulationArchive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return PopulationArchive{}, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return PopulationArchive{}, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	var a PopulationArchive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return PopulationArchive{}, fmt.Errorf("could not read population archive %s: %v", path, err)
+	}
+	return a, nil
+}
+
+// Create DNA for a random creature with a few random synapses, in a lineage of its own
+func NewRandomDNA() CreatureDNA {
+	gt := goevo.NewGenotype(gtCounter, len(creatureInputNames()), len(creatureOutputNames), goevo.ActivationLinear, goevo.ActivationTanh)
+	goevo.AddRandomSynapse(gtCounter, gt, 1, false, 5)
+	goevo.AddRandomSynapse(gtCounter, gt, 1, false, 5)
+	goevo.AddRandomSynapse(gtCounter, gt, 1, false, 5)
+	return CreatureDNA{
+		Size:                 1 + (rand.Float64()-0.5)*2,
+		Speed:                1 + (rand.Float64()-0.5)*2,
+		Diet:                 rand.Float64(),
+		PreferredTemperature: rand.Float64(),
+		Genotype:             gt,
+		Color:                RandomHSV(),
+		Vision:               1,
+		Lineage:              NewLineageID(),
+	}
+}
+
+// A random id for a new lineage
+func NewLineageID() int {
+	return rand.Intn(math.MaxInt32) + 1
+}
+
+// Add the creatures from each source to `env`
+func SeedPopulation(env *Environment, sources []PopulationSource) error {
+	if len(sources) == 0 {
+		sources = []PopulationSource{{Spawn: SpawnCentre}}
+	}
+	for _, src := range sources {
+		if err := seedFromSource(env, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seedFromSource(env *Environment, src PopulationSource) error {
+	switch src.Spawn {
+	case "":
+		src.Spawn = SpawnCentre
+	case SpawnCentre, SpawnRandom, SpawnClustered, SpawnSaved:
+	default:
+		return fmt.Errorf("unknown spawn mode '%s'", src.Spawn)
+	}
+
+	// Random creatures
+	if src.Path == "" {
+		count := src.Count
+		if count == 0 {
+			count = GlobalSP.MapParams.InitialCreaturesNumber
+		}
+		for i := 0; i < count; i++ {
+			c := NewCreature(NewRandomDNA())
+			c.Pos = env.spawnPosition(src.Spawn)
+			env.Creatures.Add(c)
+		}
+		return nil
+	}
+
+	// Creatures from an archive
+	info, err := os.Stat(src.Path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() && (strings.HasSuffix(src.Path, ".gz") || strings.HasSuffix(src.Path, ".population.json")) {
+		a, err := LoadPopulationArchive(src.Path)
+		if err != nil {
+			return err
+		}
+		for _, ac := range a.Creatures {
+			gtCounter.SafeWith(ac.DNA.Genotype)
+			// Creatures archived before lineages were recorded each start a lineage of their own, the same as DNA files
+			if ac.DNA.Lineage == 0 {
+				ac.DNA.Lineage = NewLineageID()
+			}
+			count := src.Count
+			if count == 0 {
+				count = 1
+			}
+			clusterCentre := env.spawnPosition(SpawnRandom)
+			for i := 0; i < count; i++ {
+				c := NewCreature(ac.DNA.Copied())
+				switch src.Spawn {
+				case SpawnSaved:
+					c.Pos, c.Rot = env.WrapPos(pixel.V(ac.X, ac.Y)), ac.Rot
+					if i == 0 && ac.Energy > 0 {
+						c.Energy = math.Min(ac.Energy, c.DNA.MaxEnergy())
+					}
+				case SpawnClustered:
+					c.Pos = env.spawnNear(clusterCentre)
+				default:
+					c.Pos = env.spawnPosition(src.Spawn)
+				}
+				env.Creatures.Add(c)
+			}
+		}
+		return nil
+	}
+
+	// Creatures from DNA files
+	paths := []string{src.Path}
+	if info.IsDir() {
+		paths, err = filepath.Glob(filepath.Join(src.Path, "*.json"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(paths)
+		if len(paths) == 0 {
+			return fmt.Errorf("no DNA files in %s", src.Path)
+		}
+	}
+	count := src.Count
+	if count == 0 {
+		count = 1
+	}
+	for _, path := range paths {
+		dna, err := LoadDNAFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		gtCounter.SafeWith(dna.Genotype)
+		if dna.Lineage == 0 {
+			dna.Lineage = NewLineageID()
+		}
+		clusterCentre := env.spawnPosition(SpawnRandom)
+		for i := 0; i < count; i++ {
+			c := NewCreature(dna.Copied())
+			if src.Spawn == SpawnClustered {
+				c.Pos = env.spawnNear(clusterCentre)
+			} else {
+				c.Pos = env.spawnPosition(src.Spawn)
+			}
+			env.Creatures.Add(c)
+		}
+	}
+	return nil
+}
+
+// A position to spawn a creature at. Positions from random spawning are never inside walls
+func (e *Environment) spawnPosition(mode string) pixel.Vec {
+	if mode == SpawnRandom || mode == SpawnClustered {
+		for tries := 0; tries < 1000; tries++ {
+			p := e.randomPos(float64(e.Radius - 3))
+			if !e.sampleWallAt(p, false) {
+				return p
+			}
+		}
+	}
+	return pixel.V(math.Sqrt(rand.Float64())*float64(e.Radius)*0.25, 0).Rotated(rand.Float64() * 2 * math.Pi)
+}
+
+// A position near `p` to spawn a creature at, that is not inside a wall if possible
+func (e *Environment) spawnNear(p pixel.Vec) pixel.Vec {
+	for tries := 0; tries < 100; tries++ {
+		q := p.Add(pixel.V(math.Sqrt(rand.Float64())*5, 0).Rotated(rand.Float64() * 2 * math.Pi))
+		if !e.sampleWallAt(q, false) {
+			return e.WrapPos(q)
+		}
+	}
+	return p
+}
+
+// Write the creatures to a new population archive in the populations folder
+func exportPopulation(env *Environment, creatures []*Creature, name string) error {
+	if err := os.MkdirAll("data/populations", 0755); err != nil {
+		return err
+	}
+	path := getPopulationPath(name + "_" + fmt.Sprint(time.Now().Unix()))
+	if err := SavePopulationArchive(path, NewPopulationArchive(env, creatures)); err != nil {
+		return err
+	}
+	fmt.Println("Exported", len(creatures), "creatures to", path)
+	return nil
+}
+
+func getPopulationPath(name string) string {
+	return "data/populations/" + name + ".population.json.gz"
+}
+
+// A list of strings that a flag can be given many times to fill
+type stringListFlag []string
+
+func (s *stringListFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringListFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func playCommand(args []string) error {
+	fs := flag.NewFlagSet("play", flag.ContinueOnError)
+	seeds := stringListFlag{}
+	fs.Var(&seeds, "seed", "a population archive, DNA file or directory of DNA files to seed the world with (can be given more than once)")
+	count := fs.Int("count", 0, "number of creatures to spawn from each genome (0 spawns each archived creature once, or one of each DNA file)")
+	spawn := fs.String("spawn", SpawnCentre, "where to spawn the seeded creatures: centre, random, clustered or saved")
+	random := fs.Int("random", 0, "number of random creatures to add as well as the seeds")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("unexpected arguments, use -seed to give the creatures to seed with")
+	}
+	sources := make([]PopulationSource, 0)
+	for _, path := range seeds {
+		sources = append(sources, PopulationSource{Path: path, Count: *count, Spawn: *spawn})
+	}
+	if *random > 0 || len(sources) == 0 {
+		sources = append(sources, PopulationSource{Count: *random, Spawn: *spawn})
+	}
+	GlobalSP.MapParams.InitialPopulation = sources
+	pixelgl.Run(func() { run(newDefaultEnvironment()) })
+	return nil
+}
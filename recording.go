@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// One brain update of a possessed creature: what it sensed and what the player chose to do
+type ActionSample struct {
+	SimTime float64   `json:"sim_time"`
+	Inputs  []float64 `json:"inputs"`  // In the same order as Creature.InputNames
+	Outputs []float64 `json:"outputs"` // In the same order as creatureOutputNames
+}
+
+// Writes action samples to a JSON lines file, one sample per line
+type ActionRecorder struct {
+	file    *os.File
+	encoder *json.Encoder
+	Count   int
+}
+
+func NewActionRecorder(path string) (*ActionRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ActionRecorder{
+		file:    f,
+		encoder: json.NewEncoder(f),
+	}, nil
+}
+
+func (r *ActionRecorder) Record(s ActionSample) error {
+	r.Count++
+	return r.encoder.Encode(s)
+}
+
+func (r *ActionRecorder) Close() error {
+	return r.file.Close()
+}
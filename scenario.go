@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+)
+
+// A challenge to share: the map, parameters, creatures and food to start with, and a goal to win or lose
+type Scenario struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Seed        int64              `json:"seed"`      // If not 0, the map and everything else random in the scenario is made from this seed
+	Params      json.RawMessage    `json:"params"`    // Simulation parameters to use instead of the ones in the parameters file. Parameters that are left out are not changed
+	Creatures   []PopulationSource `json:"creatures"` // Paths are relative to the scenario file
+	Food        []FoodPlacement    `json:"food"`
+	Goal        ScenarioGoal       `json:"goal"`
+}
+
+// Food to add at the start of a scenario, either scattered over the whole map or in a patch
+type FoodPlacement struct {
+	Density float64 `json:"density"` // Scatter food over the whole map with this density, the same as the scatter food tool
+	X       float64 `json:"x"`       // The centre of the patch
+	Y       float64 `json:"y"`
+	Radius  float64 `json:"radius"` // The radius of the patch. If 0, food is scattered instead
+	Count   int     `json:"count"`  // The number of food in the patch
+	Energy  float64 `json:"energy"` // The energy of each food in the patch
+	Meat    bool    `json:"meat"`   // If true, the patch is meat instead of plant food
+}
+
+// The condition to win or lose a scenario. Only creatures with a diet between `min_diet` and `max_diet` are counted
+type ScenarioGoal struct {
+	Description     string  `json:"description"`
+	MinDiet         float64 `json:"min_diet"`
+	MaxDiet         float64 `json:"max_diet"`
+	SurviveFor      float64 `json:"survive_for"`      // Win when this many sim seconds have passed. 0 for no time goal
+	ReachPopulation int     `json:"reach_population"` // Win when this many counted creatures are alive at once. 0 for no population goal
+	MinPopulation   int     `json:"min_population"`   // Lose when fewer than this many counted creatures are alive
+	TimeLimit       float64 `json:"time_limit"`       // Lose if the scenario has not been won after this many sim seconds. 0 for no limit
+	NoFeeding       bool    `json:"no_feeding"`       // Feeding creatures and scattering food by hand are not allowed
+}
+
+type ScenarioState int
+
+const (
+	ScenarioRunning ScenarioState = iota
+	ScenarioWon
+	ScenarioLost
+)
+
+// How the player is doing in a scenario
+type ScenarioStatus struct {
+	State    ScenarioState
+	Progress float64 // How close the goal is to being won, from 0 to 1
+	Message  string
+}
+
+// The scenario the game was started with, or nil
+var currentScenario *Scenario
+
+// Read a scenario file, making the paths of its creatures relative to the file
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scenario{
+		Goal: ScenarioGoal{
+			MaxDiet:       1,
+			MinPopulation: 1,
+		},
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("could not read scenario %s: %v", path, err)
+	}
+	if s.Goal.SurviveFor <= 0 && s.Goal.ReachPopulation <= 0 {
+		return nil, errors.New("scenario goal needs a survive_for time or a reach_population")
+	}
+	if s.Goal.MinDiet > s.Goal.MaxDiet {
+		return nil, errors.New("scenario goal min_diet is more than max_diet")
+	}
+	for i, src := range s.Creatures {
+		if src.Path != "" && !filepath.IsAbs(src.Path) {
+			s.Creatures[i].Path = filepath.Join(filepath.Dir(path), src.Path)
+		}
+	}
+	return s, nil
+}
+
+// Apply the parameters of the scenario over the global parameters
+func (s *Scenario) ApplyParams() error {
+	if len(s.Params) > 0 {
+		if err := json.Unmarshal(s.Params, &GlobalSP); err != nil {
+			return fmt.Errorf("invalid scenario params: %v", err)
+		}
+		if err := GlobalSP.Timeline.Validate(); err != nil {
+			GlobalSP.Timeline = nil
+			return fmt.Errorf("invalid scenario timeline: %v", err)
+		}
+	}
+	if len(s.Creatures) > 0 {
+		GlobalSP.MapParams.InitialPopulation = s.Creatures
+	}
+	return nil
+}
+
+// Create the environment for the scenario, with its creatures and food
+func (s *Scenario) NewEnvironment() (*Environment, error) {
+	if s.Seed != 0 {
+		rand.Seed(s.Seed)
+	}
+	env := NewEnvironment(GlobalSP.MapParams.MapRadius)
+	if err := SeedPopulation(env, GlobalSP.MapParams.InitialPopulation); err != nil {
+		return nil, err
+	}
+	for _, f := range s.Food {
+		if f.Radius <= 0 {
+			env.ScatterFood(f.Density)
+			continue
+		}
+		for i := 0; i < f.Count; i++ {
+			food := NewFood(f.Energy, !f.Meat)
+			food.Pos = env.WrapPos(pixel.V(f.X, f.Y).Add(pixel.V(math.Sqrt(rand.Float64())*f.Radius, 0).Rotated(rand.Float64() * 2 * math.Pi)))
+			food.Rot = rand.Float64() * 2 * math.Pi
+			env.Food.Add(food)
+		}
+	}
+	return env, nil
+}
+
+// Check how the player is doing against the goal
+func (g ScenarioGoal) Evaluate(env *Environment) ScenarioStatus {
+	count := 0
+	for _, c := range env.Creatures.Objects {
+		if c.DNA.Diet >= g.MinDiet && c.DNA.Diet <= g.MaxDiet {
+			count++
+		}
+	}
+	t := env.SimTime.Seconds()
+	status := ScenarioStatus{State: ScenarioRunning}
+	if g.SurviveFor > 0 {
+		status.Progress = t / g.SurviveFor
+		status.Message = fmt.Sprintf("%d creatures alive, survived %.0f/%.0fs", count, t, g.SurviveFor)
+	}
+	if g.ReachPopulation > 0 {
+		p := float64(count) / float64(g.ReachPopulation)
+		if p > status.Progress {
+			status.Progress = p
+		}
+		status.Message = fmt.Sprintf("%d/%d creatures alive, %.0fs", count, g.ReachPopulation, t)
+	}
+	status.Progress = math.Min(status.Progress, 1)
+	switch {
+	case count < g.MinPopulation:
+		status.State = ScenarioLost
+		status.Message = fmt.Sprintf("Lost: only %d creatures left after %.0fs", count, t)
+	case g.ReachPopulation > 0 && count >= g.ReachPopulation:
+		status.State = ScenarioWon
+		status.Message = fmt.Sprintf("Won: reached %d creatures after %.0fs", count, t)
+	case g.SurviveFor > 0 && t >= g.SurviveFor:
+		status.State = ScenarioWon
+		status.Message = fmt.Sprintf("Won: %d creatures survived for %.0fs", count, t)
+	case g.TimeLimit > 0 && t >= g.TimeLimit:
+		status.State = ScenarioLost
+		status.Message = fmt.Sprintf("Lost: ran out of time with %d creatures", count)
+	}
+	return status
+}
+
+func scenarioCommand(args []string) error {
+	fs := flag.NewFlagSet("scenario", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one scenario file")
+	}
+	s, err := LoadScenario(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := s.ApplyParams(); err != nil {
+		return err
+	}
+	env, err := s.NewEnvironment()
+	if err != nil {
+		return fmt.Errorf("could not start scenario %s: %v", s.Name, err)
+	}
+	fmt.Printf("%s\n%s\nGoal: %s\n", s.Name, s.Description, s.Goal.Description)
+	currentScenario = s
+	pixelgl.Run(func() { run(env) })
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Every creature code starts with this, so that codes can be recognised, and so that the encoding can change in future
+const creatureCodePrefix = "OCN1-"
+
+// Decoded codes larger than this are rejected, so that a bad code cannot use up all of the memory
+const maxCreatureCodeSize = 1 << 20
+
+// Encode DNA as a short line of text that can be shared in chat.
+// The code is the DNA file compressed with deflate, after a CRC-32 checksum of the file, in URL safe base64.
+// The inverse neuron order of the brain is left out to make the code shorter, as it is rebuilt when the DNA is read
+func EncodeCreatureCode(dna CreatureDNA) (string, error) {
+	data, err := json.Marshal(dna)
+	if err != nil {
+		return "", err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", err
+	}
+	var brain map[string]json.RawMessage
+	if err := json.Unmarshal(fields["brain"], &brain); err != nil {
+		return "", err
+	}
+	delete(brain, "inverse_neuron_order")
+	if fields["brain"], err = json.Marshal(brain); err != nil {
+		return "", err
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return "", err
+	}
+	b := &bytes.Buffer{}
+	binary.Write(b, binary.BigEndian, crc32.ChecksumIEEE(data))
+	w, err := flate.NewWriter(b, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return creatureCodePrefix + base64.RawURLEncoding.EncodeToString(b.Bytes()), nil
+}
+
+// Decode DNA from a code made by EncodeCreatureCode. Whitespace in the code is ignored, as chat programs often wrap long lines
+func DecodeCreatureCode(code string) (CreatureDNA, error) {
+	code = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, code)
+	if !strings.HasPrefix(code, creatureCodePrefix) {
+		return CreatureDNA{}, fmt.Errorf("creature codes start with '%s'", creatureCodePrefix)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(code, creatureCodePrefix))
+	if err != nil {
+		return CreatureDNA{}, fmt.Errorf("creature code is not valid, it may have been cut short: %v", err)
+	}
+	if len(raw) < 4 {
+		return CreatureDNA{}, errors.New("creature code is too short")
+	}
+	checksum := binary.BigEndian.Uint32(raw[:4])
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(raw[4:])), maxCreatureCodeSize+1))
+	if err != nil {
+		return CreatureDNA{}, fmt.Errorf("creature code is not valid, it may have been cut short: %v", err)
+	}
+	if len(data) > maxCreatureCodeSize {
+		return CreatureDNA{}, errors.New("creature code is too large")
+	}
+	if crc32.ChecksumIEEE(data) != checksum {
+		return CreatureDNA{}, errors.New("creature code checksum does not match, it may have been mistyped")
+	}
+	var dna CreatureDNA
+	if err := json.Unmarshal(data, &dna); err != nil {
+		return CreatureDNA{}, err
+	}
+	return dna, nil
+}
+
+func codeCommand(args []string) error {
+	fs := flag.NewFlagSet("code", flag.ContinueOnError)
+	decode := fs.Bool("d", false, "decode a creature code instead of encoding a DNA file")
+	outPath := fs.String("o", "", "when decoding, the DNA file to write (default print to the console)")
+	toLibrary := fs.String("library", "", "when decoding, also save the creature to the library with this name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one DNA file or creature code")
+	}
+
+	if !*decode {
+		dna, err := LoadDNAFile(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		code, err := EncodeCreatureCode(dna)
+		if err != nil {
+			return err
+		}
+		fmt.Println(code)
+		return nil
+	}
+
+	dna, err := DecodeCreatureCode(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *toLibrary != "" {
+		gtCounter.SafeWith(dna.Genotype)
+		entry := NewLibraryEntry(CleanLibraryName(*toLibrary), "Imported from a creature code", NewCreature(dna), 0)
+		if err := SaveLibraryEntry(entry, false); err != nil {
+			return err
+		}
+		fmt.Println("Saved creature to", getLibraryPath(entry.Name))
+	}
+	if *outPath != "" {
+		return SaveDNAFile(*outPath, dna)
+	} else if *toLibrary == "" {
+		data, err := json.MarshalIndent(dna, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCreatureCodeRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		edit func(code string) string
+	}{
+		{"unchanged", func(code string) string {
+			return code
+		}},
+		{"wrapped by a chat program", func(code string) string {
+			return code[:20] + "\n  " + code[20:40] + " " + code[40:] + "\n"
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gtCounter = &SaveLoadCounter{}
+			dna := NewRandomDNA()
+			code, err := EncodeCreatureCode(dna)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(code, creatureCodePrefix) {
+				t.Fatalf("code %s does not start with %s", code, creatureCodePrefix)
+			}
+			decoded, err := DecodeCreatureCode(tc.edit(code))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := json.Marshal(dna)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("decoded DNA\n%s\nis not the encoded DNA\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestCreatureCodeErrors(t *testing.T) {
+	// Change the bytes of a code after its prefix
+	editRaw := func(code string, edit func(raw []byte) []byte) string {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(code, creatureCodePrefix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return creatureCodePrefix + base64.RawURLEncoding.EncodeToString(edit(raw))
+	}
+	cases := []struct {
+		name    string
+		edit    func(code string) string
+		wantErr string
+	}{
+		{"no prefix", func(code string) string {
+			return strings.TrimPrefix(code, creatureCodePrefix)
+		}, "creature codes start with"},
+		{"corrupted checksum", func(code string) string {
+			return editRaw(code, func(raw []byte) []byte {
+				raw[0] ^= 0xff
+				return raw
+			})
+		}, "checksum does not match"},
+		{"cut short", func(code string) string {
+			return editRaw(code, func(raw []byte) []byte {
+				return raw[:len(raw)/2]
+			})
+		}, "cut short"},
+		{"too short", func(code string) string {
+			return editRaw(code, func(raw []byte) []byte {
+				return raw[:2]
+			})
+		}, "too short"},
+		{"not base64", func(code string) string {
+			return code + "!"
+		}, "not valid"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gtCounter = &SaveLoadCounter{}
+			code, err := EncodeCreatureCode(NewRandomDNA())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = DecodeCreatureCode(tc.edit(code))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %v, expected one containing '%s'", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package main
 
+import "github.com/JoshPattman/goevo"
+
 type SimulationParameters struct {
 	MapParams               SimulationParametersMapGen           `json:"map_generation"`          // Environment generation
 	PlantParams             SimulationParametersPlant            `json:"plant_growth"`            // Plant growth
@@ -7,14 +9,26 @@ type SimulationParameters struct {
 	CreatureBalances        SimulationParametersCreatureBalances `json:"creature_balance_values"` // Balances (between 0 and 1)
 	MutationParameters      MutationParameters                   `json:"mutation_parameters"`     // Mutation parameters
 	EnvironmentalParams     EnvironmentalParameters              `json:"environmental_parameters"`
+	Timeline                ParamTimeline                        `json:"timeline"` // Changes to numeric parameters over sim time
 }
 
 type SimulationParametersMapGen struct {
-	PlantDensity           float64 `json:"plant_density"`            // The number of plants per unit area
-	PlantCoverage          float64 `json:"plant_coverage"`           // The percentage of the map covered in plants
-	MapRadius              int     `json:"map_radius"`               // The radius of the map
-	CaveSize               float64 `json:"cave_size"`                // The size of the cave
-	InitialCreaturesNumber int     `json:"initial_creatures_number"` // The number of creatures to start with
+	PlantDensity           float64            `json:"plant_density"`            // The number of plants per unit area
+	PlantCoverage          float64            `json:"plant_coverage"`           // The percentage of the map covered in plants
+	MapRadius              int                `json:"map_radius"`               // The radius of the map
+	Shape                  string             `json:"shape"`                    // The shape of the map: circle, rectangle (a square with walls) or torus (a square that wraps around at the edges)
+	Terrain                string             `json:"terrain"`                  // The kind of terrain to generate: perlin, caves, archipelago, maze or open
+	CaveSize               float64            `json:"cave_size"`                // The size of the caves in perlin and caves terrain
+	CaveFillChance         float64            `json:"cave_fill_chance"`         // The chance that each part of the map starts as rock in caves terrain. Higher values make narrower caves
+	CaveSmoothingSteps     int                `json:"cave_smoothing_steps"`     // The number of times the caves are smoothed in caves terrain
+	IslandCount            int                `json:"island_count"`             // The number of islands in archipelago terrain
+	IslandSize             float64            `json:"island_size"`              // The size of the islands in archipelago terrain
+	MazeChannelWidth       float64            `json:"maze_channel_width"`       // The width of the channels in maze terrain
+	WallImage              string             `json:"wall_image"`               // A PNG to load the walls from instead of generating terrain, where dark pixels are walls. Empty to generate terrain
+	PlantImage             string             `json:"plant_image"`              // A PNG to load the plants from instead of growing them randomly, where green pixels are plants. Empty to grow plants randomly
+	PlantImageDensity      float64            `json:"plant_image_density"`      // How much more likely plants are to grow on the plant image than `plant_density`. A pixel of full green grows a plant with a chance of `plant_density` times this
+	InitialCreaturesNumber int                `json:"initial_creatures_number"` // The number of random creatures to start with
+	InitialPopulation      []PopulationSource `json:"initial_population"`       // The creatures to seed the world with. If empty, random creatures are made
 }
 
 type SimulationParametersPlant struct {
@@ -23,16 +37,20 @@ type SimulationParametersPlant struct {
 }
 
 type SimulationParametersCreatureBases struct {
-	MaxEnergy           float64 `json:"max_energy"`            // The energy a creature would have if its max energy multiplier was 1
-	PushForce           float64 `json:"push_force"`            // The force a creature would have if its push force multiplier was 1
-	Metabolism          float64 `json:"metabolism"`            // The energy a creature would lose if its metabolism multiplier was 1
-	Vision              float64 `json:"vision"`                // The range a creature would have if its vision multiplier was 1
-	PlantDrag           float64 `json:"plant_drag"`            // The drag a creature would have if its drag multiplier was 1
-	FoodEatRate         float64 `json:"food_eat_rate"`         // The rate at which a creature would eat food if its food eat rate multiplier was 1
-	Drag                float64 `json:"drag"`                  // The drag a creature would have if its drag multiplier was 1
-	AngularDrag         float64 `json:"angular_drag"`          // The angular drag a creature would have if its angular drag multiplier was 1
-	RotateForce         float64 `json:"rotate_force"`          // The force a creature would have if its rotate force multiplier was 1
-	MetabolismPerNeuron float64 `json:"metabolism_per_neuron"` // The amount of energy a neuron uses per tick
+	MaxEnergy                   float64                      `json:"max_energy"`                     // The energy a creature would have if its max energy multiplier was 1
+	PushForce                   float64                      `json:"push_force"`                     // The force a creature would have if its push force multiplier was 1
+	Metabolism                  float64                      `json:"metabolism"`                     // The energy a creature would lose if its metabolism multiplier was 1
+	Vision                      float64                      `json:"vision"`                         // The range a creature would have if its vision multiplier was 1
+	PlantDrag                   float64                      `json:"plant_drag"`                     // The drag a creature would have if its drag multiplier was 1
+	FoodEatRate                 float64                      `json:"food_eat_rate"`                  // The rate at which a creature would eat food if its food eat rate multiplier was 1
+	Drag                        float64                      `json:"drag"`                           // The drag a creature would have if its drag multiplier was 1
+	AngularDrag                 float64                      `json:"angular_drag"`                   // The angular drag a creature would have if its angular drag multiplier was 1
+	RotateForce                 float64                      `json:"rotate_force"`                   // The force a creature would have if its rotate force multiplier was 1
+	MetabolismPerNeuron         float64                      `json:"metabolism_per_neuron"`          // The amount of energy a neuron uses per tick
+	MetabolismPerNeuronSquared  float64                      `json:"metabolism_per_neuron_squared"`  // The amount of energy used per tick for the square of the number of hidden neurons
+	MetabolismPerSynapse        float64                      `json:"metabolism_per_synapse"`         // The amount of energy a synapse uses per tick
+	MetabolismPerSynapseSquared float64                      `json:"metabolism_per_synapse_squared"` // The amount of energy used per tick for the square of the number of synapses
+	ActivationMetabolism        map[goevo.Activation]float64 `json:"activation_metabolism"`          // The multiplier on metabolism_per_neuron for a hidden neuron with each activation (missing activations use 1)
 }
 
 type SimulationParametersCreatureBalances struct {
@@ -44,68 +62,157 @@ type SimulationParametersCreatureBalances struct {
 }
 
 type MutationParameters struct {
-	TraitMutationRate          float64 `json:"trait_mutation_rate"`          // The chance that a trait will mutate
-	TraitMutationSize          float64 `json:"trait_mutation_size"`          // The size of a trait mutation
-	SynapseMutationProbability float64 `json:"synapse_mutation_probability"` // The chance that a synapse will mutate
-	SynapseMutationSize        float64 `json:"synapse_mutation_size"`        // The size of a synapse mutation
-	SynapseGrowthProbability   float64 `json:"synapse_growth_probability"`   // The chance that a synapse will grow
-	SynapseGrowthSize          float64 `json:"synapse_growth_size"`          // The size of a synapse growth
-	NeuronGrowProbability      float64 `json:"neuron_grow_probability"`      // The chance that a neuron will grow
-	SynapsePruneProbability    float64 `json:"synapse_prune_probability"`    // The chance that a synapse will be pruned
+	TraitMutationRate             float64 `json:"trait_mutation_rate"`             // The chance that a trait will mutate
+	TraitMutationSize             float64 `json:"trait_mutation_size"`             // The size of a trait mutation
+	SynapseMutationProbability    float64 `json:"synapse_mutation_probability"`    // The chance that a synapse will mutate
+	SynapseMutationSize           float64 `json:"synapse_mutation_size"`           // The size of a synapse mutation
+	SynapseGrowthProbability      float64 `json:"synapse_growth_probability"`      // The chance that a synapse will grow
+	SynapseGrowthSize             float64 `json:"synapse_growth_size"`             // The size of a synapse growth
+	NeuronGrowProbability         float64 `json:"neuron_grow_probability"`         // The chance that a neuron will grow
+	SynapsePruneProbability       float64 `json:"synapse_prune_probability"`       // The chance that a synapse will be pruned
+	ActivationMutationProbability float64 `json:"activation_mutation_probability"` // The chance that a hidden neuron will change its activation
+	EvolveMutationRates           bool    `json:"evolve_mutation_rates"`           // If true, each creature carries its own trait and synapse mutation rates and sizes, which mutate along with it
+	MutationRateMutationSize      float64 `json:"mutation_rate_mutation_size"`     // The size of a mutation to a creature's own mutation rates (standard deviation of the log of the change)
+	MutationRateBounds            float64 `json:"mutation_rate_bounds"`            // A creature's own mutation rates are kept between the global values divided and multiplied by this
+	PruneDeadNeurons              bool    `json:"prune_dead_neurons"`              // If true, hidden neurons that can never affect the outputs are removed when a child is made, so that they stop costing energy
+	MaxHiddenNeurons              int     `json:"max_hidden_neurons"`              // The maximum number of hidden neurons a brain can grow to (0 = no limit)
+	MaxSynapses                   int     `json:"max_synapses"`                    // The maximum number of synapses a brain can grow to (0 = no limit)
 }
 
 type EnvironmentalParameters struct {
-	FoodDecayRate    float64 `json:"food_decay_rate"`    // The rate at which food decays
-	BrainUpdateDelay float64 `json:"brain_update_delay"` // The delay between brain updates
+	FoodDecayRate     float64 `json:"food_decay_rate"`     // The rate at which food decays
+	BrainUpdateDelay  float64 `json:"brain_update_delay"`  // The delay between brain updates
+	CurrentStrength   float64 `json:"current_strength"`    // The typical speed of the ocean currents. 0 turns currents off
+	CurrentScale      float64 `json:"current_scale"`       // The size of the swirls in the currents
+	CurrentChangeRate float64 `json:"current_change_rate"` // How quickly the currents change over time
+	FoodCurrentDrift  float64 `json:"food_current_drift"`  // How much food drifts with the currents, where 1 is at the speed of the water
+
+	SurfaceLight              float64 `json:"surface_light"`              // The light level in the middle of the map, where 1 lets creatures see their full vision range
+	DeepLight                 float64 `json:"deep_light"`                 // The light level at the edge of the map. At 0 creatures there can only see things within a unit of them
+	LightFalloff              float64 `json:"light_falloff"`              // How the light fades between the middle and the edge. 1 is linear, higher values keep the shallows brighter for longer
+	EnableBioluminescence     bool    `json:"enable_bioluminescence"`     // If true, creatures can evolve to glow so that others see them from further away in the dark
+	BioluminescenceMetabolism float64 `json:"bioluminescence_metabolism"` // The extra metabolism of a creature that glows at full brightness
+
+	CentreTemperature     float64 `json:"centre_temperature"`      // The temperature of the water in the middle of the map, from 0 (cold) to 1 (hot)
+	EdgeTemperature       float64 `json:"edge_temperature"`        // The temperature of the water at the edge of the map
+	TemperatureNoise      float64 `json:"temperature_noise"`       // How much patches of warmer and colder water change the temperature
+	TemperatureNoiseScale float64 `json:"temperature_noise_scale"` // The size of the patches of warmer and colder water
+	TemperatureDriftRate  float64 `json:"temperature_drift_rate"`  // How quickly the patches change over time. 0 keeps them still
+	TemperatureMetabolism float64 `json:"temperature_metabolism"`  // How much a creature's metabolism goes up for each unit of difference between the water and its preferred temperature. 0 turns temperature off
+
+	DayLength            float64 `json:"day_length"`             // The number of sim seconds in a day. 0 turns the day and night cycle off
+	NightLight           float64 `json:"night_light"`            // How much of the daytime light there is at midnight. At 0 creatures can only see things within a unit of them at midnight
+	SeasonLength         float64 `json:"season_length"`          // The number of sim seconds in a year of four seasons. 0 turns seasons off
+	SeasonPlantVariation float64 `json:"season_plant_variation"` // How much faster plants grow food in summer, and slower in winter, as a fraction of their normal growth
+	SeasonDecayVariation float64 `json:"season_decay_variation"` // How much faster food decays in summer, and slower in winter, as a fraction of the food decay rate
 }
 
-var GlobalSP = SimulationParameters{
-	MapParams: SimulationParametersMapGen{
-		MapRadius:              400,
-		PlantDensity:           0.3,
-		PlantCoverage:          0.8,
-		CaveSize:               1,
-		InitialCreaturesNumber: 300,
-	},
-
-	PlantParams: SimulationParametersPlant{
-		FoodGrowthDelay: 30,
-		GrownFoodEnergy: 5,
-	},
-
-	CreatureBaseMultipliers: SimulationParametersCreatureBases{
-		MaxEnergy:           1,
-		PushForce:           20,
-		Metabolism:          0.015,
-		Vision:              10,
-		PlantDrag:           3,
-		FoodEatRate:         5,
-		Drag:                8,
-		AngularDrag:         7,
-		RotateForce:         10,
-		MetabolismPerNeuron: 0.005,
-	},
-
-	CreatureBalances: SimulationParametersCreatureBalances{
-		ConversionEfficiencyDampPlant: 0.5,
-		ConversionEfficiencyDampMeat:  0.5,
-		DeathEnergyThreshold:          0.2,
-		PredatorEfficiencySlope:       0.75,
-		PredatorMetabolismPercentage:  0.5,
-	},
-	MutationParameters: MutationParameters{
-		TraitMutationRate:          0.2,
-		TraitMutationSize:          0.1,
-		SynapseMutationProbability: 0.2,
-		SynapseMutationSize:        0.1,
-		SynapseGrowthProbability:   0.15,
-		SynapseGrowthSize:          0.5,
-		NeuronGrowProbability:      0.05,
-		SynapsePruneProbability:    0.1,
-	},
-
-	EnvironmentalParams: EnvironmentalParameters{
-		FoodDecayRate:    0.01,
-		BrainUpdateDelay: 0.2,
-	},
+// The parameters the simulation is using
+var GlobalSP = DefaultSimParams()
+
+// The built-in parameters, which are written to the params file when there is none
+func DefaultSimParams() SimulationParameters {
+	return SimulationParameters{
+		MapParams: SimulationParametersMapGen{
+			MapRadius:              400,
+			PlantDensity:           0.3,
+			PlantCoverage:          0.8,
+			Shape:                  ShapeCircle,
+			Terrain:                TerrainPerlin,
+			CaveSize:               1,
+			CaveFillChance:         0.45,
+			CaveSmoothingSteps:     5,
+			IslandCount:            30,
+			IslandSize:             30,
+			MazeChannelWidth:       12,
+			WallImage:              "",
+			PlantImage:             "",
+			PlantImageDensity:      1,
+			InitialCreaturesNumber: 300,
+			InitialPopulation:      []PopulationSource{},
+		},
+
+		PlantParams: SimulationParametersPlant{
+			FoodGrowthDelay: 30,
+			GrownFoodEnergy: 5,
+		},
+
+		CreatureBaseMultipliers: SimulationParametersCreatureBases{
+			MaxEnergy:                   1,
+			PushForce:                   20,
+			Metabolism:                  0.015,
+			Vision:                      10,
+			PlantDrag:                   3,
+			FoodEatRate:                 5,
+			Drag:                        8,
+			AngularDrag:                 7,
+			RotateForce:                 10,
+			MetabolismPerNeuron:         0.005,
+			MetabolismPerNeuronSquared:  0,
+			MetabolismPerSynapse:        0,
+			MetabolismPerSynapseSquared: 0,
+			ActivationMetabolism: map[goevo.Activation]float64{
+				goevo.ActivationSigmoid: 1,
+				goevo.ActivationTanh:    1,
+				goevo.ActivationReLU:    0.8,
+				ActivationStep:          0.8,
+				ActivationSine:          1.5,
+				ActivationGaussian:      1.5,
+			},
+		},
+
+		CreatureBalances: SimulationParametersCreatureBalances{
+			ConversionEfficiencyDampPlant: 0.5,
+			ConversionEfficiencyDampMeat:  0.5,
+			DeathEnergyThreshold:          0.2,
+			PredatorEfficiencySlope:       0.75,
+			PredatorMetabolismPercentage:  0.5,
+		},
+		MutationParameters: MutationParameters{
+			TraitMutationRate:             0.2,
+			TraitMutationSize:             0.1,
+			SynapseMutationProbability:    0.2,
+			SynapseMutationSize:           0.1,
+			SynapseGrowthProbability:      0.15,
+			SynapseGrowthSize:             0.5,
+			NeuronGrowProbability:         0.05,
+			SynapsePruneProbability:       0.1,
+			ActivationMutationProbability: 0.05,
+			EvolveMutationRates:           false,
+			MutationRateMutationSize:      0.2,
+			MutationRateBounds:            4,
+			PruneDeadNeurons:              true,
+			MaxHiddenNeurons:              0,
+			MaxSynapses:                   0,
+		},
+
+		EnvironmentalParams: EnvironmentalParameters{
+			FoodDecayRate:     0.01,
+			BrainUpdateDelay:  0.2,
+			CurrentStrength:   0,
+			CurrentScale:      60,
+			CurrentChangeRate: 0.005,
+			FoodCurrentDrift:  1,
+
+			SurfaceLight:              1,
+			DeepLight:                 0.4,
+			LightFalloff:              2,
+			EnableBioluminescence:     false,
+			BioluminescenceMetabolism: 0.01,
+
+			CentreTemperature:     0.8,
+			EdgeTemperature:       0.2,
+			TemperatureNoise:      0.15,
+			TemperatureNoiseScale: 120,
+			TemperatureDriftRate:  0,
+			TemperatureMetabolism: 0,
+
+			DayLength:            0,
+			NightLight:           0.3,
+			SeasonLength:         0,
+			SeasonPlantVariation: 0.6,
+			SeasonDecayVariation: 0.5,
+		},
+		Timeline: ParamTimeline{},
+	}
 }
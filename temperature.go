@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math"
+
+	"github.com/aquilax/go-perlin"
+	"github.com/faiface/pixel"
+)
+
+// The temperature of the water over the whole map, from 0 (cold) to 1 (hot).
+// It changes from the middle of the map to the edge, with patches of warmer and colder water made from perlin noise
+type TemperatureField struct {
+	noise  *perlin.Perlin
+	radius float64
+	shape  string // The shape of the map. On a torus the temperature has no gradient, and the noise repeats across the edges
+}
+
+func NewTemperatureField(seed int64, radius int, shape string) *TemperatureField {
+	return &TemperatureField{
+		noise:  perlin.NewPerlin(1.8, 2, 3, seed),
+		radius: float64(radius),
+		shape:  shape,
+	}
+}
+
+// The temperature of the water at `pos` at sim time `t` seconds
+func (tf *TemperatureField) At(pos pixel.Vec, t float64) float64 {
+	ep := GlobalSP.EnvironmentalParams
+	depth := math.Min(shapeDepth(tf.shape, tf.radius, pos), 1)
+	temp := ep.CentreTemperature + (ep.EdgeTemperature-ep.CentreTemperature)*depth
+	if ep.TemperatureNoise != 0 {
+		scale := math.Max(ep.TemperatureNoiseScale, 1)
+		noise := func(x, y float64) float64 {
+			return tf.noise.Noise3D(x/scale, y/scale, t*ep.TemperatureDriftRate)
+		}
+		if tf.shape == ShapeTorus {
+			temp += ep.TemperatureNoise * 2 * periodicNoise(noise, pos.X, pos.Y, 2*tf.radius)
+		} else {
+			temp += ep.TemperatureNoise * 2 * noise(pos.X, pos.Y)
+		}
+	}
+	return math.Min(math.Max(temp, 0), 1)
+}
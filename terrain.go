@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/aquilax/go-perlin"
+	"github.com/faiface/pixel"
+)
+
+// The kinds of terrain that can be generated
+const (
+	TerrainPerlin      = "perlin"      // Caves made from perlin noise that get more open towards the middle
+	TerrainCaves       = "caves"       // Winding caves grown with a cellular automaton
+	TerrainArchipelago = "archipelago" // Open water with scattered islands of rock
+	TerrainMaze        = "maze"        // A maze of narrow channels
+	TerrainOpen        = "open"        // Open water with no walls except the edge
+)
+
+// Makes the walls of a map.
+// Generators return a grid of walls 2*radius texels wide for a map of `shape`. Everything outside the edge of the shape must be a wall,
+// and the middle quarter of the radius must be open, as that is where creatures spawn. A torus has no edge, so its walls should not block off the sides
+type TerrainGenerator interface {
+	Generate(radius int, shape string) *WallGrid
+}
+
+// Create the terrain generator chosen by the map generation params
+func NewTerrainGenerator(mp SimulationParametersMapGen) (TerrainGenerator, error) {
+	switch mp.Terrain {
+	case TerrainPerlin, "":
+		return PerlinTerrain{CaveSize: mp.CaveSize}, nil
+	case TerrainCaves:
+		return CaveTerrain{CaveSize: mp.CaveSize, FillChance: mp.CaveFillChance, SmoothingSteps: mp.CaveSmoothingSteps}, nil
+	case TerrainArchipelago:
+		return ArchipelagoTerrain{IslandCount: mp.IslandCount, IslandSize: mp.IslandSize}, nil
+	case TerrainMaze:
+		return MazeTerrain{ChannelWidth: mp.MazeChannelWidth}, nil
+	case TerrainOpen:
+		return OpenTerrain{}, nil
+	}
+	return nil, fmt.Errorf("unknown terrain '%s', expected one of %s, %s, %s, %s or %s", mp.Terrain, TerrainPerlin, TerrainCaves, TerrainArchipelago, TerrainMaze, TerrainOpen)
+}
+
+// Perlin noise caves, in rings that get more closed off further from the middle
+type PerlinTerrain struct {
+	CaveSize float64
+}
+
+func (t PerlinTerrain) Generate(radius int, shape string) *WallGrid {
+	radiusFloat := float64(radius)
+	perlinGen := perlin.NewPerlin(1.8, 2, 3, rand.Int63())
+	noise := func(u, v float64) float64 {
+		return perlinGen.Noise2D(u/(25*t.CaveSize), v/(25*t.CaveSize))
+	}
+	return fillTerrain(radius, shape, func(x, y, d float64) bool {
+		var p float64
+		if shape == ShapeTorus {
+			p = periodicNoise(noise, x+radiusFloat, y+radiusFloat, 2*radiusFloat)
+		} else {
+			p = noise(x+radiusFloat, y+radiusFloat)
+		}
+		if d < 0.25*radiusFloat {
+			return false
+		} else if d < 0.5*radiusFloat {
+			return p > 0.3
+		} else if d < 0.75*radiusFloat {
+			return p > 0.1
+		}
+		return p > 0.0
+	})
+}
+
+// Caves made by filling the map with random rock, then repeatedly making each cell a wall if most of its neighbours are.
+// The automaton runs on cells several texels across so that the caves are big enough to swim through
+type CaveTerrain struct {
+	CaveSize       float64 // The scale of the caves, where 1 runs the automaton on cells 4 texels across
+	FillChance     float64 // The chance that each cell starts as a wall
+	SmoothingSteps int     // The number of times the cellular automaton is run
+}
+
+func (t CaveTerrain) Generate(radius int, shape string) *WallGrid {
+	radiusFloat := float64(radius)
+	cellSize := math.Max(math.Round(4*t.CaveSize), 1)
+	numCells := int(math.Ceil(2 * radiusFloat / cellSize))
+	cells := NewWallGrid(numCells, func(i, j int) bool {
+		return rand.Float64() < t.FillChance
+	})
+	wrap := shape == ShapeTorus
+	cells = smoothCells(cells, t.SmoothingSteps, wrap)
+	tw := fillTerrain(radius, shape, func(x, y, d float64) bool {
+		return cells.At(int((x+radiusFloat)/cellSize), int((y+radiusFloat)/cellSize))
+	})
+	// Round off the corners of the cells
+	tw = smoothCells(tw, 2, wrap)
+	// Smoothing can grow walls into the middle and leave gaps in the edge, so put them back
+	return clearMiddleAndCloseEdge(tw, radius, shape)
+}
+
+// Run a cellular automaton on the grid `steps` times, where each cell becomes a wall if at least 5 of the 9 cells around and including it are walls.
+// Cells off the edge of the grid count as walls, unless `wrap` is set, where the grid wraps around to the opposite edge
+func smoothCells(cells *WallGrid, steps int, wrap bool) *WallGrid {
+	size := cells.Size()
+	for step := 0; step < steps; step++ {
+		prev := cells
+		cells = NewWallGrid(size, func(i, j int) bool {
+			walls := 0
+			for di := -1; di <= 1; di++ {
+				for dj := -1; dj <= 1; dj++ {
+					ni, nj := i+di, j+dj
+					if wrap {
+						ni, nj = (ni+size)%size, (nj+size)%size
+					}
+					if ni < 0 || nj < 0 || ni >= size || nj >= size || prev.At(ni, nj) {
+						walls++
+					}
+				}
+			}
+			return walls >= 5
+		})
+	}
+	return cells
+}
+
+// Open water with islands of rock, each a blob roughly `IslandSize` across
+type ArchipelagoTerrain struct {
+	IslandCount int
+	IslandSize  float64
+}
+
+func (t ArchipelagoTerrain) Generate(radius int, shape string) *WallGrid {
+	radiusFloat := float64(radius)
+	perlinGen := perlin.NewPerlin(1.8, 2, 3, rand.Int63())
+	islands := make([]pixel.Vec, t.IslandCount)
+	for i := range islands {
+		// Keep the islands out of the middle
+		minDist := 0.25*radiusFloat + t.IslandSize/2
+		if shape == ShapeCircle {
+			islands[i] = pixel.V(minDist+rand.Float64()*0.75*radiusFloat, 0).Rotated(rand.Float64() * 2 * math.Pi)
+			continue
+		}
+		// Square maps have islands all the way into the corners
+		for tries := 0; tries < 100; tries++ {
+			islands[i] = pixel.V((rand.Float64()*2-1)*radiusFloat, (rand.Float64()*2-1)*radiusFloat)
+			if edgeDistance(shape, islands[i].X, islands[i].Y) >= minDist {
+				break
+			}
+		}
+	}
+	noise := func(x, y float64) float64 {
+		return perlinGen.Noise2D(x/(t.IslandSize+1), y/(t.IslandSize+1))
+	}
+	tw := fillTerrain(radius, shape, func(x, y, d float64) bool {
+		// Make the coasts rough with noise. On a torus, the islands and the noise wrap around the edges
+		p := pixel.V(x, y)
+		var edge float64
+		if shape == ShapeTorus {
+			edge = t.IslandSize / 2 * (1 + periodicNoise(noise, x, y, 2*radiusFloat))
+		} else {
+			edge = t.IslandSize / 2 * (1 + noise(x, y))
+		}
+		for _, island := range islands {
+			offset := p.To(island)
+			if shape == ShapeTorus {
+				offset = pixel.V(wrapDelta(offset.X, 2*radiusFloat), wrapDelta(offset.Y, 2*radiusFloat))
+			}
+			if offset.Len() < edge {
+				return true
+			}
+		}
+		return false
+	})
+	return clearMiddleAndCloseEdge(tw, radius, shape)
+}
+
+// A maze of channels `ChannelWidth` wide, carved with a randomised depth first search from the middle of the map.
+// On a torus the maze wraps around the edges too
+type MazeTerrain struct {
+	ChannelWidth float64
+}
+
+func (t MazeTerrain) Generate(radius int, shape string) *WallGrid {
+	radiusFloat := float64(radius)
+	wrap := shape == ShapeTorus
+	// The maze is laid out on a grid where cells with two odd coordinates are rooms, and the cells between them are walls that can be knocked down.
+	// A wrapping maze needs an even number of cells so that the rooms on opposite edges are still one wall apart
+	cells := int(2*radiusFloat/math.Max(t.ChannelWidth, 2)) | 1
+	if wrap {
+		cells--
+	}
+	width := 2 * radiusFloat / float64(cells)
+	open := make([][]bool, cells)
+	for i := range open {
+		open[i] = make([]bool, cells)
+	}
+	mid := cells/2 | 1
+	stack := [][2]int{{mid, mid}}
+	open[mid][mid] = true
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		next := make([][2]int, 0, 4)
+		for _, dir := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			n := [2]int{cur[0] + dir[0]*2, cur[1] + dir[1]*2}
+			if wrap {
+				n = [2]int{(n[0] + cells) % cells, (n[1] + cells) % cells}
+			} else if n[0] <= 0 || n[1] <= 0 || n[0] >= cells-1 || n[1] >= cells-1 {
+				continue
+			}
+			if !open[n[0]][n[1]] {
+				next = append(next, [2]int{dir[0], dir[1]})
+			}
+		}
+		if len(next) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		dir := next[rand.Intn(len(next))]
+		wall := [2]int{(cur[0] + dir[0] + cells) % cells, (cur[1] + dir[1] + cells) % cells}
+		n := [2]int{(cur[0] + dir[0]*2 + cells) % cells, (cur[1] + dir[1]*2 + cells) % cells}
+		open[wall[0]][wall[1]] = true
+		open[n[0]][n[1]] = true
+		stack = append(stack, n)
+	}
+	tw := fillTerrain(radius, shape, func(x, y, d float64) bool {
+		i, j := minInt(int((x+radiusFloat)/width), cells-1), minInt(int((y+radiusFloat)/width), cells-1)
+		return !open[i][j]
+	})
+	return clearMiddleAndCloseEdge(tw, radius, shape)
+}
+
+// No walls except the edge of the map
+type OpenTerrain struct{}
+
+func (t OpenTerrain) Generate(radius int, shape string) *WallGrid {
+	return fillTerrain(radius, shape, func(x, y, d float64) bool {
+		return false
+	})
+}
+
+// Make the walls for a map of `radius` and `shape`, where `isWall` is given the position of each texel relative to the middle of the map and its distance from the middle.
+// Everything near or outside the edge of the shape is a wall
+func fillTerrain(radius int, shape string, isWall func(x, y, d float64) bool) *WallGrid {
+	radiusFloat := float64(radius)
+	return NewWallGrid(radius*2, func(i, j int) bool {
+		x, y := float64(i)-radiusFloat, float64(j)-radiusFloat
+		d := edgeDistance(shape, x, y)
+		return (shape != ShapeTorus && d >= radiusFloat-2) || isWall(x, y, d)
+	})
+}
+
+// Open up the middle quarter of the map for spawning, and wall off everything near or outside the edge
+func clearMiddleAndCloseEdge(tw *WallGrid, radius int, shape string) *WallGrid {
+	radiusFloat := float64(radius)
+	return NewWallGrid(tw.Size(), func(i, j int) bool {
+		d := edgeDistance(shape, float64(i)-radiusFloat, float64(j)-radiusFloat)
+		if d < 0.25*radiusFloat {
+			return false
+		} else if shape != ShapeTorus && d >= radiusFloat-2 {
+			return true
+		}
+		return tw.At(i, j)
+	})
+}
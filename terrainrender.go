@@ -0,0 +1,130 @@
+package main
+
+import (
+	"image"
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// The width in pixels of a tile of the terrain. Tiles are much bigger than the chunks of the walls so that few draw calls are needed
+const terrainTileSize = 256
+
+// The most tiles to keep sprites for before the ones that have not been drawn recently are thrown away
+const terrainMaxTiles = 256
+
+// How many frames a tile can go undrawn before its sprite can be thrown away
+const terrainTileLifetime = 120
+
+// Draws the walls and water of the map as square tiles, so that a change to the walls only has to redraw the tiles it touches.
+// Only the tiles in view are drawn, and a tile's sprite is made the first time it is drawn after it changes.
+// When zoomed out, tiles from a coarser level of detail are drawn, where a tile at level L covers 2^L texels with each of its pixels,
+// so the number of tiles on screen stays about the same at any zoom and big maps only ever have sprites for what can be seen
+type TerrainRenderer struct {
+	env   *Environment
+	tiles map[terrainTileKey]*terrainTile
+	frame int
+}
+
+type terrainTileKey struct {
+	level, tx, ty int
+}
+
+type terrainTile struct {
+	sprite    *pixel.Sprite
+	lastDrawn int // The frame the tile was last drawn in
+}
+
+func NewTerrainRenderer(env *Environment) *TerrainRenderer {
+	return &TerrainRenderer{
+		env:   env,
+		tiles: make(map[terrainTileKey]*terrainTile),
+	}
+}
+
+// Mark the tiles covering the texels from (minI, minJ) to (maxI, maxJ) inclusive as needing to be redrawn, at every level of detail
+func (r *TerrainRenderer) Invalidate(minI, minJ, maxI, maxJ int) {
+	for k := range r.tiles {
+		span := terrainTileSize << k.level
+		if k.tx >= minI/span && k.tx <= maxI/span && k.ty >= minJ/span && k.ty <= maxJ/span {
+			delete(r.tiles, k)
+		}
+	}
+}
+
+// Draw the terrain onto `t` once for each world copy in `copies`, as given by Environment.VisibleCopies.
+// `m` moves the middle of the map to where it should be drawn, and `view` is the part of the world that can be seen, with the middle of the map at the origin
+func (r *TerrainRenderer) Draw(t pixel.Target, m pixel.Matrix, view pixel.Rect, copies []pixel.Vec) {
+	r.frame++
+	// Pick the level of detail where a pixel of a tile is about a pixel on the screen
+	scale := math.Hypot(m[0], m[1])
+	level := 0
+	for level < r.maxLevel() && float64(int(2)<<level)*scale <= 1 {
+		level++
+	}
+	for _, wc := range copies {
+		r.drawLevel(t, pixel.IM.Moved(wc).Chained(m), view.Moved(wc.Scaled(-1)), level)
+	}
+	// Throw away the sprites of tiles that have gone out of view, so that panning around a big map does not keep making more
+	if len(r.tiles) > terrainMaxTiles {
+		for k, tile := range r.tiles {
+			if r.frame-tile.lastDrawn > terrainTileLifetime {
+				delete(r.tiles, k)
+			}
+		}
+	}
+}
+
+// The coarsest level of detail, where one tile covers the whole map
+func (r *TerrainRenderer) maxLevel() int {
+	level := 0
+	for terrainTileSize<<level < r.env.TexelsWall.Size() {
+		level++
+	}
+	return level
+}
+
+func (r *TerrainRenderer) drawLevel(t pixel.Target, m pixel.Matrix, view pixel.Rect, level int) {
+	radius := float64(r.env.Radius)
+	if view.Max.X < -radius || view.Max.Y < -radius || view.Min.X > radius || view.Min.Y > radius {
+		return
+	}
+	span := terrainTileSize << level
+	numTiles := (r.env.TexelsWall.Size() + span - 1) / span
+	toTile := func(x float64) int {
+		return minInt(maxInt(int(math.Floor((x+radius)/float64(span))), 0), numTiles-1)
+	}
+	for tx := toTile(view.Min.X); tx <= toTile(view.Max.X); tx++ {
+		for ty := toTile(view.Min.Y); ty <= toTile(view.Max.Y); ty++ {
+			k := terrainTileKey{level, tx, ty}
+			tile, ok := r.tiles[k]
+			if !ok {
+				tile = &terrainTile{sprite: r.makeTile(k)}
+				r.tiles[k] = tile
+			}
+			tile.lastDrawn = r.frame
+			// Sprites are drawn around their centre, and texel (0, 0) is at the bottom left of the map
+			frame := tile.sprite.Frame()
+			step := float64(int(1) << level)
+			centre := pixel.V(float64(tx*span)+frame.W()*step/2, float64(ty*span)+frame.H()*step/2).Sub(pixel.V(radius, radius))
+			tile.sprite.Draw(t, pixel.IM.Scaled(pixel.ZV, step).Moved(centre).Chained(m))
+		}
+	}
+}
+
+// Draw the pixels of a tile, where each pixel is the colour of the texel in the middle of the square of texels it covers
+func (r *TerrainRenderer) makeTile(k terrainTileKey) *pixel.Sprite {
+	size := r.env.TexelsWall.Size()
+	step := 1 << k.level
+	minI, minJ := k.tx*(terrainTileSize<<k.level), k.ty*(terrainTileSize<<k.level)
+	w, h := minInt(terrainTileSize, (size-minI+step-1)/step), minInt(terrainTileSize, (size-minJ+step-1)/step)
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < w; i++ {
+		for j := 0; j < h; j++ {
+			ti, tj := minInt(minI+i*step+step/2, size-1), minInt(minJ+j*step+step/2, size-1)
+			img.SetRGBA(i, h-j-1, r.env.texelColor(ti, tj))
+		}
+	}
+	pic := pixel.PictureDataFromImage(img)
+	return pixel.NewSprite(pic, pic.Bounds())
+}
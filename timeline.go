@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Changes to numeric parameters over sim time, so that experiments can change the environment while they run
+type ParamTimeline []ParamTrack
+
+// The values a single parameter takes over sim time.
+// Between keyframes the value is interpolated linearly, and before the first or after the last keyframe it stays at that keyframe's value
+type ParamTrack struct {
+	Param     string          `json:"param"`     // The JSON path of the parameter in the params file, such as "plant_growth.grown_food_energy"
+	Keyframes []ParamKeyframe `json:"keyframes"` // The values of the parameter at points in sim time
+}
+
+type ParamKeyframe struct {
+	Time  float64 `json:"time"`  // The sim time in seconds
+	Value float64 `json:"value"` // The value of the parameter at that time
+}
+
+// Check that every track sets a numeric parameter that exists and has usable keyframes, then sort the keyframes by time
+func (tl ParamTimeline) Validate() error {
+	for i, track := range tl {
+		if track.Param == "" {
+			return fmt.Errorf("timeline track %d has no param", i)
+		}
+		sp := reflect.New(reflect.TypeOf(SimulationParameters{})).Elem()
+		if _, err := findParam(sp, track.Param); err != nil {
+			return fmt.Errorf("timeline track %d: %v", i, err)
+		}
+		if len(track.Keyframes) == 0 {
+			return fmt.Errorf("timeline track for %s has no keyframes", track.Param)
+		}
+		for _, k := range track.Keyframes {
+			if math.IsNaN(k.Time) || math.IsInf(k.Time, 0) || math.IsNaN(k.Value) || math.IsInf(k.Value, 0) {
+				return fmt.Errorf("timeline track for %s has a keyframe that is not a finite number", track.Param)
+			}
+		}
+		sort.SliceStable(track.Keyframes, func(a, b int) bool {
+			return track.Keyframes[a].Time < track.Keyframes[b].Time
+		})
+	}
+	return nil
+}
+
+// The value of the parameter at sim time `t` seconds
+func (tr ParamTrack) ValueAt(t float64) float64 {
+	ks := tr.Keyframes
+	if t <= ks[0].Time {
+		return ks[0].Value
+	}
+	for i := 1; i < len(ks); i++ {
+		if t < ks[i].Time {
+			a, b := ks[i-1], ks[i]
+			return a.Value + (b.Value-a.Value)*(t-a.Time)/(b.Time-a.Time)
+		}
+	}
+	return ks[len(ks)-1].Value
+}
+
+// Set every parameter with a track in the timeline to its value at sim time `t` seconds
+func (sp *SimulationParameters) ApplyTimeline(t float64) {
+	root := reflect.ValueOf(sp).Elem()
+	for _, track := range sp.Timeline {
+		if len(track.Keyframes) == 0 {
+			continue
+		}
+		if p, err := findParam(root, track.Param); err == nil {
+			p.Set(track.ValueAt(t))
+		}
+	}
+}
+
+// Get the current value of the parameter at a JSON path
+func (sp *SimulationParameters) ParamValue(path string) (float64, error) {
+	p, err := findParam(reflect.ValueOf(sp).Elem(), path)
+	if err != nil {
+		return 0, err
+	}
+	return p.Get(), nil
+}
+
+// A numeric parameter, which is either a field of the parameters or an entry in a map of them
+type paramRef struct {
+	field reflect.Value
+	m     reflect.Value
+	key   reflect.Value
+}
+
+func (p paramRef) Get() float64 {
+	v := p.field
+	if p.m.IsValid() {
+		v = p.m.MapIndex(p.key)
+		if !v.IsValid() {
+			return 0
+		}
+	}
+	switch {
+	case v.CanFloat():
+		return v.Float()
+	case v.CanInt():
+		return float64(v.Int())
+	}
+	return float64(v.Uint())
+}
+
+func (p paramRef) Set(value float64) {
+	v := p.field
+	if p.m.IsValid() {
+		v = reflect.New(p.m.Type().Elem()).Elem()
+	}
+	switch {
+	case v.CanFloat():
+		v.SetFloat(value)
+	case v.CanInt():
+		v.SetInt(int64(math.Round(value)))
+	default:
+		v.SetUint(uint64(math.Max(math.Round(value), 0)))
+	}
+	if p.m.IsValid() {
+		p.m.SetMapIndex(p.key, v)
+	}
+}
+
+// Find the numeric parameter at a JSON path such as "plant_growth.grown_food_energy" inside the addressable parameters `v`.
+// The last part of the path can also be a key of a map, such as "creature_base_values.activation_metabolism.relu"
+func findParam(v reflect.Value, path string) (paramRef, error) {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		soFar := strings.Join(parts[:i], ".")
+		switch v.Kind() {
+		case reflect.Struct:
+			found := false
+			for j := 0; j < v.NumField(); j++ {
+				if name, _, _ := strings.Cut(v.Type().Field(j).Tag.Get("json"), ","); name == part {
+					v = v.Field(j)
+					found = true
+					break
+				}
+			}
+			if !found {
+				if soFar == "" {
+					return paramRef{}, fmt.Errorf("there is no parameter group called '%s'", part)
+				}
+				return paramRef{}, fmt.Errorf("%s has no parameter called '%s'", soFar, part)
+			}
+		case reflect.Map:
+			if i != len(parts)-1 || v.Type().Key().Kind() != reflect.String || !isNumericKind(v.Type().Elem().Kind()) {
+				return paramRef{}, fmt.Errorf("%s cannot be changed by a timeline", path)
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			return paramRef{m: v, key: reflect.ValueOf(part).Convert(v.Type().Key())}, nil
+		default:
+			return paramRef{}, fmt.Errorf("%s is not a group of parameters", soFar)
+		}
+	}
+	if !isNumericKind(v.Kind()) {
+		return paramRef{}, errors.New(path + " is not a number")
+	}
+	return paramRef{field: v}, nil
+}
+
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
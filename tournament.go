@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Settings for the matches of a tournament
+type tournamentOptions struct {
+	Matches        int     `json:"matches"`         // The number of matches played between each pair of entrants
+	Copies         int     `json:"copies"`          // The number of copies of each entrant at the start of a match
+	Duration       float64 `json:"duration"`        // The maximum number of sim seconds a match lasts
+	MapRadius      int     `json:"map_radius"`      // The radius of the map used for the matches
+	FoodDensity    float64 `json:"food_density"`    // The density of food scattered at the start of a match
+	Seed           int64   `json:"seed"`            // The seed of the first match. Each match after uses the next seed
+	SampleInterval float64 `json:"sample_interval"` // The number of sim seconds between samples of the population curves
+	EloK           float64 `json:"elo_k"`           // How far one match moves the Elo ratings
+}
+
+// The starting Elo rating of every entrant
+const tournamentStartingElo = 1000
+
+// A creature in a tournament, and how it did
+type TournamentEntrant struct {
+	Name                string  `json:"name"`
+	Path                string  `json:"path"`
+	Wins                int     `json:"wins"`
+	Losses              int     `json:"losses"`
+	Draws               int     `json:"draws"`
+	WinRate             float64 `json:"win_rate"` // Draws count as half a win
+	Elo                 float64 `json:"elo"`
+	MeanFinalPopulation float64 `json:"mean_final_population"`
+}
+
+// A match between two entrants. The population curves count every living descendant of each entrant
+type TournamentMatch struct {
+	A           int       `json:"a"`
+	B           int       `json:"b"`
+	Seed        int64     `json:"seed"`
+	First       int       `json:"first"`  // The index of the entrant whose copies were added first, which update first each step
+	Winner      int       `json:"winner"` // The index of the entrant with the larger population at the end, or -1 for a draw
+	Duration    float64   `json:"duration"`
+	Times       []float64 `json:"times"`
+	PopulationA []int     `json:"population_a"`
+	PopulationB []int     `json:"population_b"`
+}
+
+type TournamentReport struct {
+	Options  tournamentOptions   `json:"options"`
+	Entrants []TournamentEntrant `json:"entrants"`
+	Matches  []TournamentMatch   `json:"matches"`
+}
+
+func tournamentCommand(args []string) error {
+	fs := flag.NewFlagSet("tournament", flag.ContinueOnError)
+	opts := tournamentOptions{}
+	fs.IntVar(&opts.Matches, "matches", 5, "number of matches between each pair of creatures")
+	fs.IntVar(&opts.Copies, "copies", 20, "number of copies of each creature at the start of a match")
+	fs.Float64Var(&opts.Duration, "duration", 600, "maximum length of a match in sim seconds")
+	fs.IntVar(&opts.MapRadius, "radius", 150, "radius of the map used for the matches")
+	fs.Float64Var(&opts.FoodDensity, "food", 0.01, "density of food scattered at the start of each match")
+	fs.Int64Var(&opts.Seed, "seed", 1, "seed of the first match")
+	fs.Float64Var(&opts.SampleInterval, "sample", 10, "sim seconds between samples of the population curves")
+	fs.Float64Var(&opts.EloK, "k", 32, "Elo K factor")
+	outPath := fs.String("o", "", "path to write the JSON report to (default data/tournaments/tournament_<time>.json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("expected at least two DNA files")
+	}
+	dnas := make([]CreatureDNA, fs.NArg())
+	names := make([]string, fs.NArg())
+	for i, path := range fs.Args() {
+		dna, err := LoadDNAFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		gtCounter.SafeWith(dna.Genotype)
+		dnas[i] = dna
+		names[i] = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	report, err := RunTournament(dnas, names, opts, func(m TournamentMatch) {
+		fmt.Printf("Match %s vs %s (seed %d): ", names[m.A], names[m.B], m.Seed)
+		if m.Winner == -1 {
+			fmt.Printf("draw after %.0fs\n", m.Duration)
+		} else {
+			fmt.Printf("%s won after %.0fs\n", names[m.Winner], m.Duration)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for i := range report.Entrants {
+		report.Entrants[i].Path = fs.Arg(i)
+	}
+	fmt.Println()
+	report.WriteTable(os.Stdout)
+
+	if *outPath == "" {
+		*outPath = filepath.Join("data", "tournaments", fmt.Sprintf("tournament_%d.json", time.Now().Unix()))
+	}
+	if err := os.MkdirAll(filepath.Dir(*outPath), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*outPath, data, 0644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote report, including the population curves of every match, to", *outPath)
+	return nil
+}
+
+// Play every pair of creatures against each other `opts.Matches` times, calling `onMatch` after each match
+func RunTournament(dnas []CreatureDNA, names []string, opts tournamentOptions, onMatch func(TournamentMatch)) (TournamentReport, error) {
+	if opts.Matches < 1 || opts.Copies < 1 || opts.Duration <= 0 || opts.SampleInterval <= 0 {
+		return TournamentReport{}, errors.New("matches, copies, duration and sample interval must all be positive")
+	}
+	report := TournamentReport{Options: opts}
+	for _, name := range names {
+		report.Entrants = append(report.Entrants, TournamentEntrant{Name: name, Elo: tournamentStartingElo})
+	}
+	seed := opts.Seed
+	for round := 0; round < opts.Matches; round++ {
+		for a := range dnas {
+			for b := a + 1; b < len(dnas); b++ {
+				// The entrant that goes first swaps every round, so that neither always gets to eat and attack first
+				first := a
+				if round%2 == 1 {
+					first = b
+				}
+				m := runTournamentMatch(dnas, a, b, first, opts, seed)
+				seed++
+				report.record(m, opts.EloK)
+				report.Matches = append(report.Matches, m)
+				if onMatch != nil {
+					onMatch(m)
+				}
+			}
+		}
+	}
+	for i := range report.Entrants {
+		e := &report.Entrants[i]
+		played := e.Wins + e.Losses + e.Draws
+		if played > 0 {
+			e.WinRate = (float64(e.Wins) + 0.5*float64(e.Draws)) / float64(played)
+			e.MeanFinalPopulation /= float64(played)
+		}
+	}
+	return report, nil
+}
+
+// Update the entrants' results and Elo ratings with the result of a match
+func (r *TournamentReport) record(m TournamentMatch, k float64) {
+	a, b := &r.Entrants[m.A], &r.Entrants[m.B]
+	scoreA := 0.5
+	switch m.Winner {
+	case m.A:
+		scoreA = 1
+		a.Wins++
+		b.Losses++
+	case m.B:
+		scoreA = 0
+		a.Losses++
+		b.Wins++
+	default:
+		a.Draws++
+		b.Draws++
+	}
+	expectedA := 1 / (1 + math.Pow(10, (b.Elo-a.Elo)/400))
+	a.Elo += k * (scoreA - expectedA)
+	b.Elo -= k * (scoreA - expectedA)
+	a.MeanFinalPopulation += float64(m.PopulationA[len(m.PopulationA)-1])
+	b.MeanFinalPopulation += float64(m.PopulationB[len(m.PopulationB)-1])
+}
+
+// Run one match between entrants `a` and `b` in a fresh environment made from `seed`.
+// Each entrant's copies are given their own lineage, so that their descendants can be counted.
+// The copies of the two entrants are added in turn, starting with entrant `first`
+func runTournamentMatch(dnas []CreatureDNA, a, b, first int, opts tournamentOptions, seed int64) TournamentMatch {
+	rand.Seed(seed)
+	env := NewEnvironment(opts.MapRadius)
+	env.ScatterFood(opts.FoodDensity)
+	entrants := [2]int{a, b}
+	lineages := [2]int{a + 1, b + 1}
+	order := []int{0, 1}
+	if first == b {
+		order = []int{1, 0}
+	}
+	for i := 0; i < opts.Copies; i++ {
+		for _, side := range order {
+			dna := dnas[entrants[side]].Copied()
+			dna.Lineage = lineages[side]
+			c := NewCreature(dna)
+			c.Pos = env.spawnPosition(SpawnRandom)
+			env.Creatures.Add(c)
+		}
+	}
+
+	m := TournamentMatch{A: a, B: b, Seed: seed, First: first, Winner: -1}
+	count := func() (int, int) {
+		popA, popB := 0, 0
+		for _, c := range env.Creatures.Objects {
+			switch c.DNA.Lineage {
+			case lineages[0]:
+				popA++
+			case lineages[1]:
+				popB++
+			}
+		}
+		return popA, popB
+	}
+	sample := func(popA, popB int) {
+		m.Times = append(m.Times, env.SimTime.Seconds())
+		m.PopulationA = append(m.PopulationA, popA)
+		m.PopulationB = append(m.PopulationB, popB)
+	}
+	// The match ends as soon as one side dies out, so that a side that lasts longer wins even if both die
+	popA, popB := count()
+	sample(popA, popB)
+	nextSample := opts.SampleInterval
+	for env.SimTime.Seconds() < opts.Duration && popA > 0 && popB > 0 {
+		env.Update(1 / 60.0)
+		popA, popB = count()
+		if env.SimTime.Seconds() >= nextSample {
+			sample(popA, popB)
+			nextSample += opts.SampleInterval
+		}
+	}
+	if m.Times[len(m.Times)-1] != env.SimTime.Seconds() {
+		sample(popA, popB)
+	}
+	m.Duration = env.SimTime.Seconds()
+	if popA > popB {
+		m.Winner = a
+	} else if popB > popA {
+		m.Winner = b
+	}
+	return m
+}
+
+// Write the ranking as a human readable table, best first
+func (r TournamentReport) WriteTable(f io.Writer) {
+	ranked := append([]TournamentEntrant{}, r.Entrants...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Elo > ranked[j].Elo
+	})
+	w := tabwriter.NewWriter(f, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "rank\tcreature\telo\twin rate\twins\tlosses\tdraws\tmean final population\t")
+	for i, e := range ranked {
+		fmt.Fprintf(w, "%d\t%s\t%.0f\t%.0f%%\t%d\t%d\t%d\t%.1f\t\n", i+1, e.Name, e.Elo, e.WinRate*100, e.Wins, e.Losses, e.Draws, e.MeanFinalPopulation)
+	}
+	w.Flush()
+}
@@ -0,0 +1,93 @@
+package main
+
+// The width in texels of a chunk of the walls. Each column of a chunk is packed into the bits of one uint64
+const terrainChunkSize = 64
+
+// The walls of a map as a square grid of texels, where true is a wall.
+// The grid is stored in square chunks, and a chunk that is all wall or all water does not store its texels,
+// so that big maps, which are mostly solid rock outside the edge or open water, take little memory
+type WallGrid struct {
+	size      int
+	numChunks int
+	chunks    []wallChunk
+}
+
+type wallChunk struct {
+	texels  *[terrainChunkSize]uint64 // Bit j of texels[i] is the texel at (i, j) within the chunk, or nil if every texel is `uniform`
+	uniform bool
+}
+
+// Make a grid `size` texels wide where `isWall` decides each texel
+func NewWallGrid(size int, isWall func(i, j int) bool) *WallGrid {
+	numChunks := (size + terrainChunkSize - 1) / terrainChunkSize
+	g := &WallGrid{
+		size:      size,
+		numChunks: numChunks,
+		chunks:    make([]wallChunk, numChunks*numChunks),
+	}
+	var texels *[terrainChunkSize]uint64
+	for cx := 0; cx < numChunks; cx++ {
+		for cy := 0; cy < numChunks; cy++ {
+			// Reuse the texels of the last chunk if it turned out not to need them
+			if texels == nil {
+				texels = &[terrainChunkSize]uint64{}
+			} else {
+				*texels = [terrainChunkSize]uint64{}
+			}
+			w, h := minInt(terrainChunkSize, size-cx*terrainChunkSize), minInt(terrainChunkSize, size-cy*terrainChunkSize)
+			walls := 0
+			for i := 0; i < w; i++ {
+				for j := 0; j < h; j++ {
+					if isWall(cx*terrainChunkSize+i, cy*terrainChunkSize+j) {
+						texels[i] |= 1 << j
+						walls++
+					}
+				}
+			}
+			c := &g.chunks[cx*numChunks+cy]
+			if walls == 0 || walls == w*h {
+				c.uniform = walls != 0
+			} else {
+				c.texels = texels
+				texels = nil
+			}
+		}
+	}
+	return g
+}
+
+// The width of the grid in texels
+func (g *WallGrid) Size() int {
+	return g.size
+}
+
+// Whether the texel at (i, j) is a wall. (i, j) must be on the grid
+func (g *WallGrid) At(i, j int) bool {
+	c := &g.chunks[(i/terrainChunkSize)*g.numChunks+j/terrainChunkSize]
+	if c.texels == nil {
+		return c.uniform
+	}
+	return c.texels[i%terrainChunkSize]&(1<<(j%terrainChunkSize)) != 0
+}
+
+// Make the texel at (i, j) a wall if `wall`, or water if not. (i, j) must be on the grid
+func (g *WallGrid) Set(i, j int, wall bool) {
+	c := &g.chunks[(i/terrainChunkSize)*g.numChunks+j/terrainChunkSize]
+	if c.texels == nil {
+		if c.uniform == wall {
+			return
+		}
+		// The chunk is no longer all the same, so it needs its texels
+		c.texels = &[terrainChunkSize]uint64{}
+		if c.uniform {
+			for k := range c.texels {
+				c.texels[k] = ^uint64(0)
+			}
+		}
+	}
+	if wall {
+		c.texels[i%terrainChunkSize] |= 1 << (j % terrainChunkSize)
+	} else {
+		c.texels[i%terrainChunkSize] &^= 1 << (j % terrainChunkSize)
+	}
+}